@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ===== 用户模型 =====
+
+const (
+	RoleAuthor = "author"
+	RoleAdmin  = "admin"
+)
+
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"uniqueIndex;not null" json:"username"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+	Role         string    `gorm:"not null;default:author" json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Credentials struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// Claims JWT 中携带的用户身份
+type Claims struct {
+	UserID   uint   `json:"uid"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// 令牌有效期
+const tokenTTL = 24 * time.Hour
+
+// JWT 签名密钥，从环境变量 BLOG_JWT_SECRET 读取
+var jwtSecret []byte
+
+var errUsernameTaken = errors.New("username already taken")
+
+// ===== 初始化签名密钥 =====
+func initJWT() error {
+	secret := os.Getenv("BLOG_JWT_SECRET")
+	if secret != "" {
+		jwtSecret = []byte(secret)
+		return nil
+	}
+
+	// 未配置时生成随机密钥，重启后已签发的令牌全部失效
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	jwtSecret = []byte(hex.EncodeToString(buf))
+	log.Println("BLOG_JWT_SECRET not set, using a random key; tokens will not survive a restart")
+	return nil
+}
+
+// ===== 工具函数 =====
+
+func signToken(user User) (string, time.Time, error) {
+	expiresAt := time.Now().Add(tokenTTL)
+	claims := Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.Username,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	return token, expiresAt, err
+}
+
+func parseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// currentUser 返回 AuthRequired 中间件解析出的令牌信息
+func currentUser(c *gin.Context) *Claims {
+	claims, _ := c.MustGet("claims").(*Claims)
+	return claims
+}
+
+// optionalUser 返回 OptionalAuth 中间件解析出的令牌信息，匿名访问时返回 nil
+func optionalUser(c *gin.Context) *Claims {
+	value, ok := c.Get("claims")
+	if !ok {
+		return nil
+	}
+	claims, _ := value.(*Claims)
+	return claims
+}
+
+// canModify 只有文章作者本人或管理员可以修改文章
+func canModify(claims *Claims, article Article) bool {
+	return claims.Role == RoleAdmin || (article.AuthorID != 0 && article.AuthorID == claims.UserID)
+}
+
+// ===== 中间件 =====
+
+// AuthRequired 校验 Authorization: Bearer <token>
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			fail(c, 401, "Missing bearer token")
+			c.Abort()
+			return
+		}
+
+		claims, err := parseToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			fail(c, 401, "Invalid or expired token")
+			c.Abort()
+			return
+		}
+
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// OptionalAuth 允许匿名访问；带了 Authorization 时与 AuthRequired 一样校验令牌
+func OptionalAuth() gin.HandlerFunc {
+	authRequired := AuthRequired()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authRequired(c)
+	}
+}
+
+// ===== API 处理器 =====
+
+// Register 注册用户，第一个注册的用户成为管理员
+// POST /api/auth/register
+func Register(c *gin.Context) {
+	var cred Credentials
+	if err := c.ShouldBindJSON(&cred); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	// binding:"required" 只检查非空，纯空白的用户名在去掉空格后同样无效
+	username := strings.TrimSpace(cred.Username)
+	if username == "" {
+		fail(c, 400, "username cannot be empty")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(cred.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Error hashing password:", err)
+		fail(c, 500, "Failed to register user")
+		return
+	}
+
+	user := User{
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         RoleAuthor,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUsernameTaken
+		}
+
+		if err := tx.Model(&User{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			user.Role = RoleAdmin
+		}
+
+		return tx.Create(&user).Error
+	})
+
+	if errors.Is(err, errUsernameTaken) {
+		fail(c, 409, "Username already taken")
+		return
+	}
+	if err != nil {
+		log.Println("Error creating user:", err)
+		fail(c, 500, "Failed to register user")
+		return
+	}
+
+	success(c, user, "User registered successfully")
+}
+
+// Login 登录并签发 JWT
+// POST /api/auth/login
+func Login(c *gin.Context) {
+	var cred Credentials
+	if err := c.ShouldBindJSON(&cred); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	var user User
+	result := db.Where("username = ?", strings.TrimSpace(cred.Username)).First(&user)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		fail(c, 401, "Invalid username or password")
+		return
+	}
+
+	if result.Error != nil {
+		fail(c, 500, "Failed to log in")
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(cred.Password)) != nil {
+		fail(c, 401, "Invalid username or password")
+		return
+	}
+
+	token, expiresAt, err := signToken(user)
+	if err != nil {
+		log.Println("Error signing token:", err)
+		fail(c, 500, "Failed to log in")
+		return
+	}
+
+	success(c, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+		"user":       user,
+	}, "Login successful")
+}
+
+// GetMe 获取当前登录用户
+// GET /api/auth/me
+func GetMe(c *gin.Context) {
+	var user User
+	result := db.First(&user, currentUser(c).UserID)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		fail(c, 404, "User not found")
+		return
+	}
+
+	if result.Error != nil {
+		fail(c, 500, "Failed to retrieve user")
+		return
+	}
+
+	success(c, user, "Success")
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===== 评论模型 =====
+
+// 评论审核状态
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+)
+
+// 回复的最大嵌套层数（顶层评论为 0）
+const maxCommentDepth = 8
+
+// Comment 文章评论，ParentID 指向被回复的评论，形成评论树
+// 删除是软删除：有回复的评论仍保留在树中，内容显示为已删除
+type Comment struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	ArticleID uint           `gorm:"index;not null" json:"article_id"`
+	ParentID  *uint          `gorm:"index" json:"parent_id"`
+	Depth     int            `gorm:"not null;default:0" json:"depth"`
+	AuthorID  uint           `gorm:"index" json:"author_id"`
+	Author    string         `json:"author"`
+	Content   string         `gorm:"not null" json:"content"`
+	Status    string         `gorm:"index;not null;default:approved" json:"status"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Deleted   bool           `gorm:"-" json:"deleted"`
+	Replies   []*Comment     `gorm:"-" json:"replies,omitempty"`
+}
+
+type CommentInput struct {
+	Content  string `json:"content" binding:"required"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type CommentStatusInput struct {
+	Status string `json:"status" binding:"required,oneof=pending approved spam"`
+}
+
+// 是否先审核后显示，通过环境变量 BLOG_MODERATE_COMMENTS=true 开启
+var moderateComments = os.Getenv("BLOG_MODERATE_COMMENTS") == "true"
+
+// ===== 工具函数 =====
+
+// canModifyComment 评论作者本人或管理员可以编辑、删除评论
+func canModifyComment(claims *Claims, comment Comment) bool {
+	return claims.Role == RoleAdmin || (comment.AuthorID != 0 && comment.AuthorID == claims.UserID)
+}
+
+// initialStatus 管理员和文章作者的评论直接通过，其他人的评论在开启审核时进入待审核
+func initialStatus(claims *Claims, article Article) string {
+	if !moderateComments || claims.Role == RoleAdmin || article.AuthorID == claims.UserID {
+		return CommentApproved
+	}
+	return CommentPending
+}
+
+// visibleComments 公开可见的评论：已通过且未删除
+func visibleComments() *gorm.DB {
+	return db.Model(&Comment{}).Where("status = ?", CommentApproved)
+}
+
+// commentCounts 统计每篇文章可见的评论数
+func commentCounts(articleIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(articleIDs))
+	if len(articleIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ArticleID uint
+		Count     int64
+	}
+	err := visibleComments().
+		Select("article_id, COUNT(*) AS count").
+		Where("article_id IN ?", articleIDs).
+		Group("article_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ArticleID] = row.Count
+	}
+	return counts, nil
+}
+
+// attachCommentCounts 为文章列表填充 comment_count
+func attachCommentCounts(articles []Article) {
+	ids := make([]uint, len(articles))
+	for i, article := range articles {
+		ids[i] = article.ID
+	}
+
+	counts, err := commentCounts(ids)
+	if err != nil {
+		log.Println("Error counting comments:", err)
+		return
+	}
+	for i := range articles {
+		articles[i].CommentCount = counts[articles[i].ID]
+	}
+}
+
+// buildCommentTree 把按时间排序的评论组装成树
+// 已删除且没有可见回复的评论会被剪掉
+func buildCommentTree(comments []*Comment) []*Comment {
+	byID := make(map[uint]*Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	roots := []*Comment{}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		// 父评论不可见（例如被标为垃圾评论）时，整个分支都不显示
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(comments []*Comment) []*Comment {
+	kept := comments[:0]
+	for _, comment := range comments {
+		comment.Replies = pruneDeleted(comment.Replies)
+		if comment.Deleted && len(comment.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// flattenCommentTree 按深度优先顺序展开评论树，配合 depth 字段渲染缩进
+func flattenCommentTree(roots []*Comment) []*Comment {
+	flat := []*Comment{}
+	var walk func(comments []*Comment)
+	walk = func(comments []*Comment) {
+		for _, comment := range comments {
+			flat = append(flat, comment)
+			walk(comment.Replies)
+			comment.Replies = nil
+		}
+	}
+	walk(roots)
+	return flat
+}
+
+// findArticle 按 ID 查找文章，不存在时返回 404
+func findArticle(c *gin.Context, id string) (Article, bool) {
+	var article Article
+	if err := db.First(&article, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, 404, "Article not found")
+		} else {
+			fail(c, 500, "Failed to retrieve article")
+		}
+		return article, false
+	}
+	return article, true
+}
+
+// findComment 按 ID 查找未删除的评论，不存在时返回 404
+func findComment(c *gin.Context) (Comment, bool) {
+	var comment Comment
+	if err := db.First(&comment, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, 404, "Comment not found")
+		} else {
+			fail(c, 500, "Failed to retrieve comment")
+		}
+		return comment, false
+	}
+	return comment, true
+}
+
+// ===== 评论 API =====
+
+// GetComments 获取文章的评论
+// GET /api/articles/:id/comments?format=tree|flat
+func GetComments(c *gin.Context) {
+	article, ok := findVisibleArticle(c, c.Param("id"), optionalUser(c))
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "tree")
+	if format != "tree" && format != "flat" {
+		fail(c, 400, "format must be tree or flat")
+		return
+	}
+
+	// 已删除的评论也要取出来，用于保留回复的上下文
+	var comments []*Comment
+	err := visibleComments().Unscoped().
+		Where("article_id = ?", article.ID).
+		Order("created_at, id").
+		Find(&comments).Error
+	if err != nil {
+		fail(c, 500, "Failed to retrieve comments")
+		return
+	}
+
+	for _, comment := range comments {
+		if comment.DeletedAt.Valid {
+			comment.Deleted = true
+			comment.Content = ""
+			comment.Author = ""
+			comment.AuthorID = 0
+		}
+	}
+
+	tree := buildCommentTree(comments)
+	if format == "flat" {
+		success(c, flattenCommentTree(tree), "Success")
+		return
+	}
+	success(c, tree, "Success")
+}
+
+// CreateComment 发表评论或回复
+// POST /api/articles/:id/comments
+func CreateComment(c *gin.Context) {
+	article, ok := findVisibleArticle(c, c.Param("id"), currentUser(c))
+	if !ok {
+		return
+	}
+
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	content := strings.TrimSpace(input.Content)
+	if content == "" {
+		fail(c, 400, "Comment content is required")
+		return
+	}
+
+	claims := currentUser(c)
+	comment := Comment{
+		ArticleID: article.ID,
+		ParentID:  input.ParentID,
+		AuthorID:  claims.UserID,
+		Author:    claims.Username,
+		Content:   content,
+		Status:    initialStatus(claims, article),
+	}
+
+	// 回复只能指向同一篇文章下已通过、未删除的评论
+	if input.ParentID != nil {
+		var parent Comment
+		err := db.Where("id = ? AND article_id = ? AND status = ?", *input.ParentID, article.ID, CommentApproved).
+			First(&parent).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, 400, "Parent comment not found on this article")
+			return
+		}
+		if err != nil {
+			fail(c, 500, "Failed to create comment")
+			return
+		}
+		if parent.Depth+1 > maxCommentDepth {
+			fail(c, 400, "Maximum reply depth is "+strconv.Itoa(maxCommentDepth))
+			return
+		}
+		comment.Depth = parent.Depth + 1
+	}
+
+	if err := db.Create(&comment).Error; err != nil {
+		log.Println("Error creating comment:", err)
+		fail(c, 500, "Failed to create comment")
+		return
+	}
+
+	message := "Comment created successfully"
+	if comment.Status == CommentPending {
+		message = "Comment submitted and awaiting review"
+	}
+	success(c, comment, message)
+}
+
+// UpdateComment 编辑评论内容
+// PUT /api/comments/:id
+func UpdateComment(c *gin.Context) {
+	comment, ok := findComment(c)
+	if !ok {
+		return
+	}
+
+	if !canModifyComment(currentUser(c), comment) {
+		fail(c, 403, "Only the author or an admin can edit this comment")
+		return
+	}
+
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	content := strings.TrimSpace(input.Content)
+	if content == "" {
+		fail(c, 400, "Comment content is required")
+		return
+	}
+
+	if err := db.Model(&comment).Update("content", content).Error; err != nil {
+		log.Println("Error updating comment:", err)
+		fail(c, 500, "Failed to update comment")
+		return
+	}
+
+	success(c, comment, "Comment updated successfully")
+}
+
+// DeleteComment 软删除评论，回复仍然保留
+// DELETE /api/comments/:id
+func DeleteComment(c *gin.Context) {
+	comment, ok := findComment(c)
+	if !ok {
+		return
+	}
+
+	if !canModifyComment(currentUser(c), comment) {
+		fail(c, 403, "Only the author or an admin can delete this comment")
+		return
+	}
+
+	if err := db.Delete(&comment).Error; err != nil {
+		log.Println("Error deleting comment:", err)
+		fail(c, 500, "Failed to delete comment")
+		return
+	}
+
+	success(c, gin.H{"id": comment.ID}, "Comment deleted successfully")
+}
+
+// GetModerationQueue 按状态列出评论，供管理员审核
+// GET /api/comments?status=pending&page=1&limit=10
+func GetModerationQueue(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	status := c.DefaultQuery("status", CommentPending)
+	if status != CommentPending && status != CommentApproved && status != CommentSpam {
+		fail(c, 400, "status must be one of pending, approved, spam")
+		return
+	}
+
+	pageNum, pageSize := paginate(c)
+	offset := (pageNum - 1) * pageSize
+
+	var comments []Comment
+	var total int64
+
+	query := db.Model(&Comment{}).Where("status = ?", status)
+	query.Session(&gorm.Session{}).Count(&total)
+
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&comments).Error
+	if err != nil {
+		fail(c, 500, "Failed to retrieve comments")
+		return
+	}
+
+	success(c, gin.H{
+		"comments": comments,
+		"total":    total,
+		"page":     pageNum,
+		"limit":    pageSize,
+	}, "Success")
+}
+
+// ModerateComment 修改评论审核状态
+// PUT /api/comments/:id/status
+func ModerateComment(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	comment, ok := findComment(c)
+	if !ok {
+		return
+	}
+
+	var input CommentStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	if err := db.Model(&comment).Update("status", input.Status).Error; err != nil {
+		log.Println("Error moderating comment:", err)
+		fail(c, 500, "Failed to update comment status")
+		return
+	}
+
+	success(c, comment, "Comment status updated")
+}
@@ -1,30 +1,118 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
 // ===== 数据模型 =====
 
 type Article struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Title     string    `json:"title" binding:"required"`
-	Content   string    `json:"content" binding:"required"`
-	Author    string    `json:"author" binding:"required"`
-	Category  string    `json:"category"`
-	ViewCount int       `json:"view_count" gorm:"default:0"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Title      string    `json:"title" binding:"required"`
+	Content    string    `json:"content" binding:"required"`
+	AuthorID   uint      `json:"author_id" gorm:"index"`
+	Author     string    `json:"author"`
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	Category   *Category `json:"category"`
+	Tags       []Tag     `json:"tags" gorm:"many2many:article_tags"`
+	ViewCount  int       `json:"view_count" gorm:"default:0"`
+	// 发布状态：draft / scheduled / published / archived，只有 published 的文章公开
+	Status      string     `json:"status" gorm:"index;not null;default:draft"`
+	PublishedAt *time.Time `json:"published_at" gorm:"index"`
+	// 可见评论数，查询后单独统计
+	CommentCount int64     `json:"comment_count" gorm:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ArticleInput 创建/更新文章的请求体
+// category 为分类名称，tags 为标签名称列表（不传时更新接口保持原标签不变）
+// status 不传时新文章为草稿、更新时保持原状态，scheduled 需要同时传入将来的 published_at
+type ArticleInput struct {
+	Title       string     `json:"title" binding:"required"`
+	Content     string     `json:"content" binding:"required"`
+	Category    string     `json:"category"`
+	Tags        []string   `json:"tags"`
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+// ArticlePatch 部分更新文章的请求体，字段为 nil（未传）表示不修改
+// category 传空字符串或 null 表示清除分类，tags 传 [] 或 null 表示清除所有标签，view_count 只有管理员可以修改
+// 其他字段不能为 null，由 checkPatchFields 检查
+type ArticlePatch struct {
+	Title     *string   `json:"title"`
+	Content   *string   `json:"content"`
+	Category  *string   `json:"category"`
+	Tags      *[]string `json:"tags"`
+	ViewCount *int      `json:"view_count"`
+	// status 和 published_at 任意一个出现时重新计算发布状态
+	Status      *string    `json:"status"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+// articlePatchFields PATCH 请求体中可以出现的字段（值为 true 的可以为 null），articleReadOnlyFields 为文章中只读的字段
+var (
+	articlePatchFields = map[string]bool{
+		"title": false, "content": false, "category": true, "tags": true,
+		"view_count": false, "status": false, "published_at": false,
+	}
+	articleReadOnlyFields = map[string]bool{
+		"id": true, "author_id": true, "author": true, "category_id": true,
+		"comment_count": true, "created_at": true, "updated_at": true,
+	}
+)
+
+// checkPatchFields 检查 PATCH 请求体中的字段，包含只读或未知字段、不能清除的字段为 null 时返回错误，
+// 而不是静默忽略；返回值为 null 的字段
+func checkPatchFields(body []byte) (map[string]bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nulls := map[string]bool{}
+	for _, name := range names {
+		if articleReadOnlyFields[name] {
+			return nil, fmt.Errorf("%s is read-only", name)
+		}
+		nullable, ok := articlePatchFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field: %s", name)
+		}
+		if string(fields[name]) == "null" {
+			if !nullable {
+				return nil, fmt.Errorf("%s cannot be null", name)
+			}
+			nulls[name] = true
+		}
+	}
+	return nulls, nil
 }
 
 type ResponseData struct {
-	Code    int         `json:"code"`      // 0 成功, 非 0 失败
+	Code    int         `json:"code"` // 0 成功, 非 0 失败
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
 }
@@ -33,17 +121,42 @@ type ResponseData struct {
 var db *gorm.DB
 
 // ===== 初始化数据库 =====
-func initDB() error {
-	var err error
 
-	// 使用 SQLite 数据库
+// openDB 打开 SQLite 数据库
+func openDB() error {
+	var err error
 	db, err = gorm.Open(sqlite.Open("blog.db"), &gorm.Config{})
+	return err
+}
+
+// initDB 检查表结构是否为最新，并检查全文索引是否可用
+func initDB(autoMigrate bool) error {
+	err := openDB()
 	if err != nil {
 		return err
 	}
 
-	// 自动迁移（创建表）
-	err = db.AutoMigrate(&Article{})
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	if autoMigrate {
+		// 本地开发：执行迁移后再用 AutoMigrate 同步模型中尚未写成迁移的改动
+		if _, err = runMigrations(migrations); err != nil {
+			return err
+		}
+		log.Println("AutoMigrate enabled, do not use in production")
+		err = db.AutoMigrate(&Article{}, &User{}, &Category{}, &Tag{}, &Comment{}, &ArticleRevision{}, &ArticleViewDaily{})
+	} else {
+		err = requireSchemaUpToDate(migrations)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 全文搜索索引（由迁移建立，这里只检查）
+	err = initSearch()
 	if err != nil {
 		return err
 	}
@@ -62,7 +175,7 @@ func success(c *gin.Context, data interface{}, message string) {
 	})
 }
 
-func error(c *gin.Context, code int, message string) {
+func fail(c *gin.Context, code int, message string) {
 	c.JSON(http.StatusOK, ResponseData{
 		Code:    code,
 		Message: message,
@@ -70,19 +183,10 @@ func error(c *gin.Context, code int, message string) {
 	})
 }
 
-// ===== API 处理器 =====
-
-// GetArticles 获取文章列表（支持分页）
-// GET /api/articles?page=1&limit=10
-func GetArticles(c *gin.Context) {
-	var articles []Article
-	var total int64
-
-	page := c.DefaultQuery("page", "1")
-	limit := c.DefaultQuery("limit", "10")
-
-	pageNum, _ := strconv.Atoi(page)
-	pageSize, _ := strconv.Atoi(limit)
+// paginate 解析 page / limit 分页参数
+func paginate(c *gin.Context) (int, int) {
+	pageNum, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 
 	if pageNum < 1 {
 		pageNum = 1
@@ -90,20 +194,39 @@ func GetArticles(c *gin.Context) {
 	if pageSize < 1 || pageSize > 50 {
 		pageSize = 10
 	}
+	return pageNum, pageSize
+}
+
+// ===== API 处理器 =====
+
+// GetArticles 获取文章列表（支持分页和标签过滤），匿名用户只能看到已发布的文章
+// GET /api/articles?page=1&limit=10&tags=go,web&tag_mode=all
+func GetArticles(c *gin.Context) {
+	var articles []Article
+	var total int64
 
+	pageNum, pageSize := paginate(c)
 	offset := (pageNum - 1) * pageSize
 
+	query := visibleArticles(db.Model(&Article{}), optionalUser(c))
+	if slugs := tagSlugs(splitList(c.Query("tags"))); len(slugs) > 0 {
+		query = filterByTags(query, slugs, c.DefaultQuery("tag_mode", "any"))
+	}
+
 	// 获取总数
-	db.Model(&Article{}).Count(&total)
+	query.Session(&gorm.Session{}).Count(&total)
 
-	// 分页查询
-	result := db.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&articles)
+	// 分页查询（按发布时间倒序，未发布的草稿排在最后）
+	result := query.Preload("Category").Preload("Tags").
+		Offset(offset).Limit(pageSize).Order("published_at DESC, created_at DESC").Find(&articles)
 
 	if result.Error != nil {
-		error(c, 500, "Failed to retrieve articles")
+		fail(c, 500, "Failed to retrieve articles")
 		return
 	}
 
+	attachCommentCounts(articles)
+
 	success(c, gin.H{
 		"articles": articles,
 		"total":    total,
@@ -118,20 +241,31 @@ func GetArticleByID(c *gin.Context) {
 	id := c.Param("id")
 
 	var article Article
-	result := db.First(&article, id)
+	result := db.Preload("Category").Preload("Tags").First(&article, id)
 
 	if result.Error == gorm.ErrRecordNotFound {
-		error(c, 404, "Article not found")
+		fail(c, 404, "Article not found")
 		return
 	}
 
 	if result.Error != nil {
-		error(c, 500, "Failed to retrieve article")
+		fail(c, 500, "Failed to retrieve article")
+		return
+	}
+
+	// 未发布的文章对其他人来说不存在
+	if !canView(optionalUser(c), article) {
+		fail(c, 404, "Article not found")
 		return
 	}
 
-	// 增加浏览次数
-	db.Model(&article).Update("view_count", article.ViewCount+1)
+	// 增加浏览次数（只统计已发布的文章），计数先缓存在内存中，返回值包含尚未写入的部分
+	if article.Status == ArticlePublished {
+		views.record(article.ID, visitorID(c), time.Now())
+		article.ViewCount += int(views.pendingFor(article.ID))
+	}
+
+	visibleComments().Where("article_id = ?", article.ID).Count(&article.CommentCount)
 
 	success(c, article, "Success")
 }
@@ -139,60 +273,260 @@ func GetArticleByID(c *gin.Context) {
 // CreateArticle 创建文章
 // POST /api/articles
 func CreateArticle(c *gin.Context) {
-	var article Article
+	var input ArticleInput
 
 	// 绑定和验证 JSON 数据
-	if err := c.ShouldBindJSON(&article); err != nil {
-		error(c, 400, err.Error())
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
 		return
 	}
 
-	// 创建记录
-	result := db.Create(&article)
+	// 作者信息来自令牌
+	claims := currentUser(c)
+	article := Article{
+		Title:    input.Title,
+		Content:  input.Content,
+		AuthorID: claims.UserID,
+		Author:   claims.Username,
+	}
 
-	if result.Error != nil {
-		log.Println("Error creating article:", result.Error)
-		error(c, 500, "Failed to create article")
+	// 不指定 status 时保存为草稿
+	var err error
+	article.Status, article.PublishedAt, err = resolvePublishing(article, input.Status, input.PublishedAt, time.Now())
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	// 创建记录（分类和标签不存在时一并创建）
+	err = db.Transaction(func(tx *gorm.DB) error {
+		category, err := resolveCategory(tx, input.Category)
+		if err != nil {
+			return err
+		}
+		if category != nil {
+			article.CategoryID = &category.ID
+			article.Category = category
+		}
+
+		article.Tags, err = resolveTags(tx, input.Tags)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&article).Error; err != nil {
+			return err
+		}
+		// 新文章的内容作为第 1 个修订
+		return recordRevision(tx, article.ID, newRevision(claims))
+	})
+
+	if err != nil {
+		log.Println("Error creating article:", err)
+		fail(c, 500, "Failed to create article")
 		return
 	}
 
 	success(c, article, "Article created successfully")
 }
 
-// UpdateArticle 更新文章
+// UpdateArticle 更新文章（整体替换标题、内容和分类）
 // PUT /api/articles/:id
 func UpdateArticle(c *gin.Context) {
-	id := c.Param("id")
-
-	var article Article
-	var updateData Article
+	article, ok := findArticle(c, c.Param("id"))
+	if !ok {
+		return
+	}
 
-	// 检查文章是否存在
-	if err := db.First(&article, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			error(c, 404, "Article not found")
-		} else {
-			error(c, 500, "Failed to retrieve article")
-		}
+	if !canModify(currentUser(c), article) {
+		fail(c, 403, "Only the author or an admin can update this article")
 		return
 	}
 
 	// 绑定更新数据
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		error(c, 400, err.Error())
+	var input ArticleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
 		return
 	}
 
-	// 更新记录（只更新非零值字段）
-	result := db.Model(&article).Updates(updateData)
+	// status 不传时保持原状态
+	status, publishedAt, err := resolvePublishing(article, input.Status, input.PublishedAt, time.Now())
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
 
-	if result.Error != nil {
-		log.Println("Error updating article:", result.Error)
-		error(c, 500, "Failed to update article")
+	// category 为空时清除分类；tags 不传时保持原标签
+	updates := map[string]interface{}{
+		"title":        input.Title,
+		"content":      input.Content,
+		"status":       status,
+		"published_at": publishedAt,
+	}
+	var tags *[]string
+	if input.Tags != nil {
+		tags = &input.Tags
+	}
+	if err := saveArticle(&article, updates, &input.Category, tags, newRevision(currentUser(c))); err != nil {
+		log.Println("Error updating article:", err)
+		fail(c, 500, "Failed to update article")
+		return
+	}
+
+	sendReloadedArticle(c, article.ID, "Article updated successfully")
+}
+
+// PatchArticle 部分更新文章，只修改请求体中出现的字段
+// PATCH /api/articles/:id
+func PatchArticle(c *gin.Context) {
+	article, ok := findArticle(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	claims := currentUser(c)
+	if !canModify(claims, article) {
+		fail(c, 403, "Only the author or an admin can update this article")
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	nulls, err := checkPatchFields(body)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+	var patch ArticlePatch
+	if err := json.Unmarshal(body, &patch); err != nil {
+		fail(c, 400, err.Error())
 		return
 	}
+	// null 与空值一样表示清除
+	if nulls["category"] {
+		patch.Category = new(string)
+	}
+	if nulls["tags"] {
+		patch.Tags = &[]string{}
+	}
 
-	success(c, article, "Article updated successfully")
+	// 出现的字段（包括空字符串、0 等零值）都会写入
+	updates := map[string]interface{}{}
+	if patch.Title != nil {
+		if strings.TrimSpace(*patch.Title) == "" {
+			fail(c, 400, "title cannot be empty")
+			return
+		}
+		updates["title"] = *patch.Title
+	}
+	if patch.Content != nil {
+		if strings.TrimSpace(*patch.Content) == "" {
+			fail(c, 400, "content cannot be empty")
+			return
+		}
+		updates["content"] = *patch.Content
+	}
+	if patch.ViewCount != nil {
+		if claims.Role != RoleAdmin {
+			fail(c, 403, "Only an admin can change view_count")
+			return
+		}
+		if *patch.ViewCount < 0 {
+			fail(c, 400, "view_count cannot be negative")
+			return
+		}
+		updates["view_count"] = *patch.ViewCount
+	}
+	if patch.Status != nil || patch.PublishedAt != nil {
+		var status string
+		if patch.Status != nil {
+			status = *patch.Status
+		}
+		status, publishedAt, err := resolvePublishing(article, status, patch.PublishedAt, time.Now())
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+		updates["status"] = status
+		updates["published_at"] = publishedAt
+	}
+
+	save := func() error {
+		return saveArticle(&article, updates, patch.Category, patch.Tags, newRevision(claims))
+	}
+	if patch.ViewCount != nil {
+		// 重置浏览数时丢弃尚未写入的计数，写入期间后台任务不会写入计数
+		err = views.reset(article.ID, save)
+	} else {
+		err = save()
+	}
+	if err != nil {
+		log.Println("Error updating article:", err)
+		fail(c, 500, "Failed to update article")
+		return
+	}
+
+	sendReloadedArticle(c, article.ID, "Article updated successfully")
+}
+
+// saveArticle 在一个事务中写入文章字段、分类和标签，并把更新后的文章保存为新的修订
+// updates 用 map 传入，零值也会写入；category / tags 为 nil 时保持不变，
+// category 为空字符串时清除分类，tags 为空列表时清除所有标签
+func saveArticle(article *Article, updates map[string]interface{}, category *string, tags *[]string, revision ArticleRevision) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if category != nil {
+			resolved, err := resolveCategory(tx, *category)
+			if err != nil {
+				return err
+			}
+			if resolved != nil {
+				updates["category_id"] = resolved.ID
+			} else {
+				updates["category_id"] = nil
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(article).Omit("Category", "Tags").Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		// 重置浏览数时同时清除每日统计，之后的 daily_views 从重置时开始重新累计
+		if _, ok := updates["view_count"]; ok {
+			if err := tx.Where("article_id = ?", article.ID).Delete(&ArticleViewDaily{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if tags != nil {
+			resolved, err := resolveTags(tx, *tags)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(article).Association("Tags").Replace(resolved); err != nil {
+				return err
+			}
+		}
+
+		return recordRevision(tx, article.ID, revision)
+	})
+}
+
+// sendReloadedArticle 更新后重新读取文章（含分类、标签和评论数）再返回，而不是返回更新前的结构体
+func sendReloadedArticle(c *gin.Context, id uint, message string) {
+	var article Article
+	if err := db.Preload("Category").Preload("Tags").First(&article, id).Error; err != nil {
+		fail(c, 500, "Failed to retrieve article")
+		return
+	}
+	visibleComments().Where("article_id = ?", article.ID).Count(&article.CommentCount)
+
+	success(c, article, message)
 }
 
 // DeleteArticle 删除文章
@@ -204,90 +538,146 @@ func DeleteArticle(c *gin.Context) {
 	var article Article
 	if err := db.First(&article, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			error(c, 404, "Article not found")
+			fail(c, 404, "Article not found")
 		} else {
-			error(c, 500, "Failed to retrieve article")
+			fail(c, 500, "Failed to retrieve article")
 		}
 		return
 	}
 
-	// 删除记录
-	result := db.Delete(&article)
-
-	if result.Error != nil {
-		log.Println("Error deleting article:", result.Error)
-		error(c, 500, "Failed to delete article")
-		return
-	}
-
-	success(c, gin.H{"id": id}, "Article deleted successfully")
-}
-
-// SearchArticles 搜索文章
-// GET /api/articles/search?q=keyword
-func SearchArticles(c *gin.Context) {
-	keyword := c.Query("q")
-
-	if keyword == "" {
-		error(c, 400, "Search keyword is required")
+	if !canModify(currentUser(c), article) {
+		fail(c, 403, "Only the author or an admin can delete this article")
 		return
 	}
 
-	var articles []Article
-	result := db.Where("title LIKE ? OR content LIKE ? OR author LIKE ?", 
-		"%"+keyword+"%", 
-		"%"+keyword+"%", 
-		"%"+keyword+"%").
-		Order("created_at DESC").
-		Find(&articles)
+	// 删除记录（连同标签关联、评论、修订历史和浏览统计）
+	// 评论带有软删除字段，这里必须用 Unscoped 物理删除，否则会留下指向不存在文章的评论
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("article_id = ?", article.ID).Delete(&Comment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("article_id = ?", article.ID).Delete(&ArticleRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("article_id = ?", article.ID).Delete(&ArticleViewDaily{}).Error; err != nil {
+			return err
+		}
+		return tx.Select("Tags").Delete(&article).Error
+	})
 
-	if result.Error != nil {
-		error(c, 500, "Failed to search articles")
+	if err != nil {
+		log.Println("Error deleting article:", err)
+		fail(c, 500, "Failed to delete article")
 		return
 	}
+	views.discard(article.ID)
 
-	success(c, articles, "Search completed")
+	success(c, gin.H{"id": id}, "Article deleted successfully")
 }
 
-// GetArticlesByCategory 按分类获取文章
-// GET /api/articles/category/:name
+// GetArticlesByCategory 按分类获取文章（按 slug 匹配，不区分大小写），匿名用户只能看到已发布的文章
+// GET /api/category/:name
 func GetArticlesByCategory(c *gin.Context) {
-	category := c.Param("name")
+	slug := slugify(c.Param("name"))
 
 	var articles []Article
-	result := db.Where("category = ?", category).Order("created_at DESC").Find(&articles)
+	result := visibleArticles(db.Preload("Category").Preload("Tags"), optionalUser(c)).
+		Joins("JOIN categories ON categories.id = articles.category_id").
+		Where("categories.slug = ?", slug).
+		Order("articles.published_at DESC, articles.created_at DESC").
+		Find(&articles)
 
 	if result.Error != nil {
-		error(c, 500, "Failed to retrieve articles")
+		fail(c, 500, "Failed to retrieve articles")
 		return
 	}
 
 	success(c, articles, "Success")
 }
 
-// GetStats 获取统计信息
-// GET /api/stats
+// GetStats 获取统计信息（只统计已发布的文章），daily_views 为最近 days 天每天的浏览数
+// GET /api/stats?days=7
 func GetStats(c *gin.Context) {
 	var total int64
 	var totalViews int64
+	var totalComments int64
+	var pendingComments int64
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 90 {
+		fail(c, 400, "days must be between 1 and 90")
+		return
+	}
+
+	published := func() *gorm.DB { return visibleArticles(db.Model(&Article{}), nil) }
+	published().Count(&total)
+	published().Select("COALESCE(SUM(view_count), 0)").Row().Scan(&totalViews)
+	visibleComments().Count(&totalComments)
+	db.Model(&Comment{}).Where("status = ?", CommentPending).Count(&pendingComments)
 
-	db.Model(&Article{}).Count(&total)
-	db.Model(&Article{}).Select("COALESCE(SUM(view_count), 0)").Row().Scan(&totalViews)
+	trend, err := dailyViews(days, time.Now())
+	if err != nil {
+		log.Println("Error retrieving daily views:", err)
+		fail(c, 500, "Failed to retrieve statistics")
+		return
+	}
 
 	success(c, gin.H{
-		"total_articles": total,
-		"total_views":    totalViews,
+		"total_articles":   total,
+		"total_views":      totalViews,
+		"total_comments":   totalComments,
+		"pending_comments": pendingComments,
+		"daily_views":      trend,
 	}, "Success")
 }
 
 // ===== 路由配置 =====
 
 func main() {
+	migrateOnly := flag.Bool("migrate", false, "apply pending schema migrations and exit")
+	dryRun := flag.Bool("dry-run", false, "print the SQL of pending migrations and exit")
+	autoMigrate := flag.Bool("automigrate", false, "apply migrations and GORM AutoMigrate on startup (local development only)")
+	flag.Parse()
+
+	// 迁移与服务分开执行
+	if *migrateOnly || *dryRun {
+		if err := openDB(); err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		migrations, err := loadMigrations()
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if *dryRun {
+			err = printPendingMigrations(os.Stdout, migrations)
+		} else {
+			var ran []Migration
+			ran, err = runMigrations(migrations)
+			if err == nil && len(ran) == 0 {
+				log.Println("No pending migrations")
+			}
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	// 初始化数据库
-	if err := initDB(); err != nil {
+	if err := initDB(*autoMigrate); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// 初始化 JWT 签名密钥
+	if err := initJWT(); err != nil {
+		log.Fatalf("Failed to initialize JWT secret: %v", err)
+	}
+
+	// 后台任务：发布到期的定时文章、定期写入浏览计数
+	background, stopBackground := context.WithCancel(context.Background())
+	startPublisher(background)
+	views.start(background)
+
 	// 创建 Gin 路由器
 	router := gin.Default()
 
@@ -296,7 +686,7 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -312,19 +702,63 @@ func main() {
 	// API 路由
 	api := router.Group("/api")
 	{
+		// 认证路由
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", Register)       // 注册
+			auth.POST("/login", Login)             // 登录，签发 JWT
+			auth.GET("/me", AuthRequired(), GetMe) // 当前用户
+		}
+
 		// 文章相关路由
 		articles := api.Group("/articles")
 		{
-			articles.GET("", GetArticles)           // 获取文章列表
-			articles.GET("/:id", GetArticleByID)    // 获取单篇文章
-			articles.POST("", CreateArticle)        // 创建文章
-			articles.PUT("/:id", UpdateArticle)     // 更新文章
-			articles.DELETE("/:id", DeleteArticle)  // 删除文章
+			articles.GET("", OptionalAuth(), GetArticles)          // 获取文章列表
+			articles.GET("/mine", AuthRequired(), GetMyArticles)   // 我的文章（含草稿）
+			articles.GET("/:id", OptionalAuth(), GetArticleByID)   // 获取单篇文章
+			articles.POST("", AuthRequired(), CreateArticle)       // 创建文章
+			articles.PUT("/:id", AuthRequired(), UpdateArticle)    // 更新文章
+			articles.PATCH("/:id", AuthRequired(), PatchArticle)   // 部分更新文章
+			articles.DELETE("/:id", AuthRequired(), DeleteArticle) // 删除文章
+
+			articles.GET("/:id/comments", OptionalAuth(), GetComments)    // 获取评论（树形或扁平）
+			articles.POST("/:id/comments", AuthRequired(), CreateComment) // 发表评论或回复
+
+			articles.GET("/:id/revisions", AuthRequired(), GetRevisions)                  // 修订列表（作者/管理员）
+			articles.GET("/:id/revisions/diff", AuthRequired(), DiffRevisions)            // 比较两个修订
+			articles.GET("/:id/revisions/:rev", AuthRequired(), GetRevision)              // 获取单个修订
+			articles.POST("/:id/revisions/:rev/restore", AuthRequired(), RestoreRevision) // 恢复旧修订
+		}
+
+		// 评论路由
+		comments := api.Group("/comments", AuthRequired())
+		{
+			comments.GET("", GetModerationQueue)         // 审核队列（管理员）
+			comments.PUT("/:id", UpdateComment)          // 编辑评论（作者/管理员）
+			comments.DELETE("/:id", DeleteComment)       // 删除评论（作者/管理员）
+			comments.PUT("/:id/status", ModerateComment) // 修改审核状态（管理员）
 		}
 
 		// 搜索和分类路由
-		api.GET("/search", SearchArticles)                    // 搜索文章
-		api.GET("/category/:name", GetArticlesByCategory)     // 按分类获取
+		api.GET("/search", OptionalAuth(), SearchArticles)                // 搜索文章
+		api.GET("/category/:name", OptionalAuth(), GetArticlesByCategory) // 按分类获取
+
+		// 标签路由（管理操作需要管理员）
+		tags := api.Group("/tags")
+		{
+			tags.GET("", GetTags)                             // 标签列表及文章数
+			tags.PUT("/:id", AuthRequired(), RenameTag)       // 重命名标签
+			tags.POST("/:id/merge", AuthRequired(), MergeTag) // 合并标签
+		}
+
+		// 分类路由（管理操作需要管理员）
+		categories := api.Group("/categories")
+		{
+			categories.GET("", GetCategories)                         // 分类列表及文章数
+			categories.POST("", AuthRequired(), CreateCategory)       // 创建分类
+			categories.PUT("/:id", AuthRequired(), RenameCategory)    // 重命名分类
+			categories.DELETE("/:id", AuthRequired(), DeleteCategory) // 删除分类
+		}
 
 		// 统计信息
 		api.GET("/stats", GetStats)
@@ -339,16 +773,57 @@ func main() {
 
 	log.Println("Server starting on http://localhost:8080")
 	log.Println("API Documentation:")
+	log.Println("  POST   /api/auth/register         - Register user")
+	log.Println("  POST   /api/auth/login            - Log in and get JWT")
+	log.Println("  GET    /api/auth/me               - Get current user")
 	log.Println("  GET    /api/articles              - Get articles (with pagination)")
+	log.Println("  GET    /api/articles/mine         - Get my articles including drafts (auth)")
 	log.Println("  GET    /api/articles/:id          - Get article by ID")
-	log.Println("  POST   /api/articles              - Create article")
-	log.Println("  PUT    /api/articles/:id          - Update article")
-	log.Println("  DELETE /api/articles/:id          - Delete article")
-	log.Println("  GET    /api/search?q=keyword     - Search articles")
-	log.Println("  GET    /api/category/:name       - Get articles by category")
+	log.Println("  POST   /api/articles              - Create article (auth)")
+	log.Println("  PUT    /api/articles/:id          - Update article (author/admin)")
+	log.Println("  PATCH  /api/articles/:id          - Partially update article (author/admin)")
+	log.Println("  DELETE /api/articles/:id          - Delete article (author/admin)")
+	log.Println("  GET    /api/articles/:id/comments - Get comments (format=tree|flat)")
+	log.Println("  POST   /api/articles/:id/comments - Create comment or reply (auth)")
+	log.Println("  GET    /api/articles/:id/revisions - List revisions (author/admin)")
+	log.Println("  GET    /api/articles/:id/revisions/diff?from=&to= - Diff two revisions (author/admin)")
+	log.Println("  GET    /api/articles/:id/revisions/:rev - Get revision (author/admin)")
+	log.Println("  POST   /api/articles/:id/revisions/:rev/restore - Restore revision (author/admin)")
+	log.Println("  GET    /api/comments              - Moderation queue (admin)")
+	log.Println("  PUT    /api/comments/:id          - Edit comment (author/admin)")
+	log.Println("  DELETE /api/comments/:id          - Delete comment (author/admin)")
+	log.Println("  PUT    /api/comments/:id/status   - Set comment status (admin)")
+	log.Println("  GET    /api/search?q=keyword     - Full-text search articles")
+	log.Println("  GET    /api/category/:name       - Get articles by category slug")
+	log.Println("  GET    /api/tags                 - List tags with article counts")
+	log.Println("  PUT    /api/tags/:id             - Rename tag (admin)")
+	log.Println("  POST   /api/tags/:id/merge       - Merge tag into another (admin)")
+	log.Println("  GET    /api/categories           - List categories with article counts")
+	log.Println("  POST   /api/categories           - Create category (admin)")
+	log.Println("  PUT    /api/categories/:id       - Rename category (admin)")
+	log.Println("  DELETE /api/categories/:id       - Delete category (admin)")
 	log.Println("  GET    /api/stats                - Get statistics")
 
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Server error: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// 优雅停止：收到 SIGINT / SIGTERM 后等待处理中的请求结束，再停止后台任务并写入剩余的浏览计数
+	<-ctx.Done()
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down server:", err)
 	}
+	stopBackground()
+	<-views.done
+	log.Println("Server stopped")
 }
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ===== 数据库迁移 =====
+//
+// 表结构由 migrations/NNNN_name.sql 定义，编译时嵌入二进制，按编号顺序执行。
+// 执行过的迁移连同文件的 SHA-256 校验和记录在 schema_migrations 表中，
+// 已执行的迁移文件被修改时拒绝继续，新的结构变更应该写成新的迁移文件。
+// 文件开头的注释 "-- requires: fts5" 表示迁移需要编译进 FTS5 模块。
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// 引入迁移之前由 AutoMigrate 建立的数据库，对应到这个版本为止的迁移
+const legacyBaselineVersion = 3
+
+type Migration struct {
+	Version      int
+	Name         string
+	SQL          string
+	Checksum     string
+	RequiresFTS5 bool
+}
+
+// SchemaMigration schema_migrations 表中的一条记录
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	Checksum  string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// loadMigrations 读取嵌入的迁移文件，按编号排序
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := map[int]string{}
+	for _, entry := range entries {
+		file := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 || !strings.HasSuffix(file, ".sql") {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.sql", file)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migration version %04d is used by both %s and %s", version, other, file)
+		}
+		seen[version] = file
+
+		content, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+
+		migrations = append(migrations, Migration{
+			Version:      version,
+			Name:         name,
+			SQL:          string(content),
+			Checksum:     hex.EncodeToString(sum[:]),
+			RequiresFTS5: migrationRequires(string(content), "fts5"),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// migrationRequires 检查迁移文件开头的注释中是否有 "-- requires: <feature>"
+func migrationRequires(script, feature string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+		if strings.TrimSpace(strings.TrimPrefix(line, "--")) == "requires: "+feature {
+			return true
+		}
+	}
+	return false
+}
+
+// deferMigration 判断迁移在当前构建中是否暂不执行：需要 FTS5 而构建中没有时，
+// 设置了 BLOG_SEARCH_FALLBACK=like 则保持未执行（换成带 FTS5 的构建后再执行），否则返回错误
+func deferMigration(tx *gorm.DB, m Migration) (bool, error) {
+	if !m.RequiresFTS5 || fts5Available(tx) {
+		return false, nil
+	}
+	if searchFallback {
+		return true, nil
+	}
+	return false, fmt.Errorf("migration %04d_%s requires FTS5: build with -tags sqlite_fts5, or set BLOG_SEARCH_FALLBACK=like to skip it",
+		m.Version, m.Name)
+}
+
+// appliedMigrations 读取已执行的迁移；schema_migrations 不存在时返回空
+func appliedMigrations() (map[int]SchemaMigration, error) {
+	applied := map[int]SchemaMigration{}
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// pendingMigrations 校验已执行迁移的校验和，返回尚未执行的迁移
+func pendingMigrations(migrations []Migration) ([]Migration, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[int]bool{}
+	var pending []Migration
+	for _, m := range migrations {
+		known[m.Version] = true
+		row, ok := applied[m.Version]
+		if !ok {
+			pending = append(pending, m)
+			continue
+		}
+		if row.Checksum != m.Checksum {
+			return nil, fmt.Errorf("migration %04d_%s was modified after it was applied (checksum %s, file %s)",
+				m.Version, m.Name, row.Checksum[:12], m.Checksum[:12])
+		}
+	}
+
+	for version, row := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("database has migration %04d_%s which this binary does not know about", version, row.Name)
+		}
+	}
+	return pending, nil
+}
+
+// isLegacyDatabase 判断数据库是否是引入迁移之前由 AutoMigrate 创建的
+func isLegacyDatabase() bool {
+	return !db.Migrator().HasTable(&SchemaMigration{}) && db.Migrator().HasTable(&Article{})
+}
+
+// 引入迁移之前的 articles 表可能缺少的列，需要先补上才能建立索引
+var legacyArticleColumns = [][2]string{
+	{"author_id", "integer"},
+}
+
+// baselineLegacyDatabase 把旧数据库补齐到 legacyBaselineVersion，并记录对应的迁移
+// 旧数据库的结构取决于当时的代码版本，这里以幂等方式重放基线迁移：
+// 已存在的表和索引跳过，已存在的列不再添加
+func baselineLegacyDatabase(migrations []Migration) error {
+	log.Printf("Existing database without schema_migrations, upgrading it to migration %04d", legacyBaselineVersion)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range legacyColumnStatements(tx) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, m := range migrations {
+			if m.Version > legacyBaselineVersion {
+				break
+			}
+			if err := replayIdempotent(tx, m); err != nil {
+				return fmt.Errorf("baseline %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		// 旧版分类文本列迁移为分类实体
+		if err := migrateLegacyCategories(tx); err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().CreateTable(&SchemaMigration{}); err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.Version > legacyBaselineVersion {
+				break
+			}
+			row := SchemaMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum, AppliedAt: time.Now().UTC()}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// replayIdempotent 逐条执行迁移语句，跳过已经存在的表、索引和列
+func replayIdempotent(tx *gorm.DB, m Migration) error {
+	for _, stmt := range idempotentStatements(tx, m) {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idempotentStatements 把迁移语句改写成可以重复执行的形式：建表和索引加上 IF NOT EXISTS，
+// 已经存在的列不再添加
+func idempotentStatements(tx *gorm.DB, m Migration) []string {
+	var stmts []string
+	for _, stmt := range splitStatements(m.SQL) {
+		fields := strings.Fields(stmt)
+		switch {
+		case strings.HasPrefix(stmt, "CREATE TABLE "):
+			stmt = "CREATE TABLE IF NOT EXISTS " + strings.TrimPrefix(stmt, "CREATE TABLE ")
+		case strings.HasPrefix(stmt, "CREATE INDEX "):
+			stmt = "CREATE INDEX IF NOT EXISTS " + strings.TrimPrefix(stmt, "CREATE INDEX ")
+		case strings.HasPrefix(stmt, "CREATE UNIQUE INDEX "):
+			stmt = "CREATE UNIQUE INDEX IF NOT EXISTS " + strings.TrimPrefix(stmt, "CREATE UNIQUE INDEX ")
+		case len(fields) > 5 && strings.HasPrefix(stmt, "ALTER TABLE ") && fields[3] == "ADD" && fields[4] == "COLUMN":
+			if tx.Migrator().HasColumn(fields[2], fields[5]) {
+				continue
+			}
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// splitStatements 按分号拆分迁移文件并去掉注释行（迁移文件中不使用包含分号的字符串）
+func splitStatements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// legacyColumnStatements 返回为旧数据库补上 legacyArticleColumns 中缺少的列的语句
+func legacyColumnStatements(tx *gorm.DB) []string {
+	var stmts []string
+	for _, col := range legacyArticleColumns {
+		if !tx.Migrator().HasColumn("articles", col[0]) {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE articles ADD COLUMN %s %s", col[0], col[1]))
+		}
+	}
+	return stmts
+}
+
+// runMigrations 在各自的事务中依次执行未执行的迁移
+func runMigrations(migrations []Migration) ([]Migration, error) {
+	if isLegacyDatabase() {
+		if err := baselineLegacyDatabase(migrations); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range pending {
+		skip, err := deferMigration(db, m)
+		if err != nil {
+			return ran, err
+		}
+		if skip {
+			log.Printf("Skipping migration %04d_%s: FTS5 not available, it stays pending until run with an FTS5 build", m.Version, m.Name)
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.SQL).Error; err != nil {
+				return err
+			}
+			row := SchemaMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum, AppliedAt: time.Now().UTC()}
+			return tx.Create(&row).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// printPendingMigrations 输出将要执行的 SQL，不修改数据库
+func printPendingMigrations(w io.Writer, migrations []Migration) error {
+	if isLegacyDatabase() {
+		fmt.Fprintf(w, "-- existing database without schema_migrations, upgrading it to migration %04d:\n", legacyBaselineVersion)
+		fmt.Fprintf(w, "-- existing tables, indexes and columns are skipped, migrations 0001-%04d are then recorded as applied\n\n",
+			legacyBaselineVersion)
+		for _, stmt := range legacyColumnStatements(db) {
+			fmt.Fprintf(w, "%s;\n", stmt)
+		}
+		fmt.Fprintln(w)
+
+		var rest []Migration
+		for _, m := range migrations {
+			if m.Version > legacyBaselineVersion {
+				rest = append(rest, m)
+				continue
+			}
+			fmt.Fprintf(w, "-- baseline %04d_%s (sha256 %s)\n", m.Version, m.Name, m.Checksum)
+			for _, stmt := range idempotentStatements(db, m) {
+				fmt.Fprintf(w, "%s;\n", stmt)
+			}
+			fmt.Fprintln(w)
+		}
+		if db.Migrator().HasColumn("articles", "category") {
+			fmt.Fprintf(w, "-- values of the legacy articles.category column are converted to categories and articles.category_id\n\n")
+		}
+		migrations = rest
+	}
+
+	pending, err := pendingMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "-- database is up to date")
+		return nil
+	}
+
+	for _, m := range pending {
+		skip, err := deferMigration(db, m)
+		if err != nil {
+			return err
+		}
+		if skip {
+			fmt.Fprintf(w, "-- %04d_%s skipped: requires FTS5, stays pending (BLOG_SEARCH_FALLBACK=like)\n\n", m.Version, m.Name)
+			continue
+		}
+		fmt.Fprintf(w, "-- %04d_%s (sha256 %s)\n", m.Version, m.Name, m.Checksum)
+		fmt.Fprintln(w, strings.TrimSpace(m.SQL))
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// requireSchemaUpToDate 启动服务前检查迁移，有未执行的迁移时拒绝启动
+func requireSchemaUpToDate(migrations []Migration) error {
+	if isLegacyDatabase() {
+		return fmt.Errorf("database predates schema migrations, run with -migrate first")
+	}
+
+	all, err := pendingMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	// 没有 FTS5 时暂不执行的迁移不影响启动
+	var pending []Migration
+	for _, m := range all {
+		skip, err := deferMigration(db, m)
+		if err != nil {
+			return err
+		}
+		if !skip {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migration(s) starting at %04d_%s, run with -migrate first",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+-- 文章和用户
+CREATE TABLE articles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    title text,
+    content text,
+    author_id integer,
+    author text,
+    view_count integer DEFAULT 0,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE INDEX idx_articles_author_id ON articles(author_id);
+
+CREATE TABLE users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    username text NOT NULL,
+    password_hash text NOT NULL,
+    role text NOT NULL DEFAULT "author",
+    created_at datetime
+);
+
+CREATE UNIQUE INDEX idx_users_username ON users(username);
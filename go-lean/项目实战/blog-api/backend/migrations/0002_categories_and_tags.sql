@@ -0,0 +1,31 @@
+-- 分类和标签，分类与文章一对多，标签与文章多对多
+CREATE TABLE categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    slug text NOT NULL,
+    created_at datetime
+);
+
+CREATE UNIQUE INDEX idx_categories_slug ON categories(slug);
+
+ALTER TABLE articles ADD COLUMN category_id integer
+    CONSTRAINT fk_articles_category REFERENCES categories(id);
+
+CREATE INDEX idx_articles_category_id ON articles(category_id);
+
+CREATE TABLE tags (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    slug text NOT NULL,
+    created_at datetime
+);
+
+CREATE UNIQUE INDEX idx_tags_slug ON tags(slug);
+
+CREATE TABLE article_tags (
+    article_id integer,
+    tag_id integer,
+    PRIMARY KEY (article_id, tag_id),
+    CONSTRAINT fk_article_tags_article FOREIGN KEY (article_id) REFERENCES articles(id),
+    CONSTRAINT fk_article_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
@@ -0,0 +1,20 @@
+-- 评论，parent_id 构成评论树，deleted_at 用于软删除
+CREATE TABLE comments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    article_id integer NOT NULL,
+    parent_id integer,
+    depth integer NOT NULL DEFAULT 0,
+    author_id integer,
+    author text,
+    content text NOT NULL,
+    status text NOT NULL DEFAULT "approved",
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+
+CREATE INDEX idx_comments_article_id ON comments(article_id);
+CREATE INDEX idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX idx_comments_author_id ON comments(author_id);
+CREATE INDEX idx_comments_status ON comments(status);
+CREATE INDEX idx_comments_deleted_at ON comments(deleted_at);
@@ -0,0 +1,10 @@
+-- 文章发布状态，新文章默认为草稿，定时文章到 published_at 时由后台任务发布
+ALTER TABLE articles ADD COLUMN status text NOT NULL DEFAULT "draft";
+
+ALTER TABLE articles ADD COLUMN published_at datetime;
+
+-- 已有的文章在创建时就已公开
+UPDATE articles SET status = "published", published_at = created_at;
+
+CREATE INDEX idx_articles_status ON articles(status);
+CREATE INDEX idx_articles_published_at ON articles(published_at);
@@ -0,0 +1,28 @@
+-- 文章修订历史，每次创建和更新文章时保存一份快照
+CREATE TABLE article_revisions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    article_id integer NOT NULL,
+    revision integer NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    category text,
+    tags text,
+    status text,
+    editor_id integer,
+    editor text,
+    restored_from integer,
+    created_at datetime
+);
+
+-- 不使用 UNIQUE：GORM 的 SQLite 驱动会把联合唯一索引误认为每一列都唯一，导致 -automigrate 失败
+CREATE INDEX idx_article_revisions_revision ON article_revisions(article_id, revision);
+CREATE INDEX idx_article_revisions_editor_id ON article_revisions(editor_id);
+
+-- 已有的文章以当前内容作为第 1 个修订，编辑者记为作者
+INSERT INTO article_revisions (article_id, revision, title, content, category, tags, status, editor_id, editor, created_at)
+SELECT articles.id, 1, articles.title, articles.content, COALESCE(categories.name, ''),
+    COALESCE((SELECT json_group_array(tags.name) FROM article_tags JOIN tags ON tags.id = article_tags.tag_id
+        WHERE article_tags.article_id = articles.id), '[]'),
+    articles.status, articles.author_id, articles.author, COALESCE(articles.updated_at, articles.created_at)
+FROM articles
+LEFT JOIN categories ON categories.id = articles.category_id;
@@ -0,0 +1,9 @@
+-- 文章每天的浏览数（UTC 日期），由浏览计数的后台任务批量累加
+CREATE TABLE article_views_daily (
+    article_id integer NOT NULL,
+    day text NOT NULL,
+    views integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (article_id, day)
+);
+
+CREATE INDEX idx_article_views_daily_day ON article_views_daily(day);
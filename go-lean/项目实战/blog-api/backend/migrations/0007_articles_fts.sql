@@ -0,0 +1,29 @@
+-- requires: fts5
+-- 文章全文索引：articles 的 FTS5 外部内容表，由触发器在文章增删改时同步
+-- 使用 IF NOT EXISTS：这个迁移之前的版本在启动时直接建立了同样的索引和触发器
+CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(
+    title, content, author,
+    content='articles', content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS articles_fts_insert AFTER INSERT ON articles BEGIN
+    INSERT INTO articles_fts(rowid, title, content, author)
+    VALUES (new.id, new.title, new.content, new.author);
+END;
+
+CREATE TRIGGER IF NOT EXISTS articles_fts_delete AFTER DELETE ON articles BEGIN
+    INSERT INTO articles_fts(articles_fts, rowid, title, content, author)
+    VALUES ('delete', old.id, old.title, old.content, old.author);
+END;
+
+-- 只在被索引的列变化时重建索引，浏览数更新不会触发
+CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE OF title, content, author ON articles BEGIN
+    INSERT INTO articles_fts(articles_fts, rowid, title, content, author)
+    VALUES ('delete', old.id, old.title, old.content, old.author);
+    INSERT INTO articles_fts(rowid, title, content, author)
+    VALUES (new.id, new.title, new.content, new.author);
+END;
+
+-- 为已有文章建立索引
+INSERT INTO articles_fts(articles_fts) VALUES ('rebuild');
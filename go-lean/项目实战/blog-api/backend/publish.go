@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===== 发布流程 =====
+
+// 文章状态：草稿只有作者可见，定时文章到 published_at 时由后台任务发布，归档文章不再公开
+const (
+	ArticleDraft     = "draft"
+	ArticleScheduled = "scheduled"
+	ArticlePublished = "published"
+	ArticleArchived  = "archived"
+)
+
+// 检查定时文章的间隔
+const publishInterval = 30 * time.Second
+
+func validStatus(status string) bool {
+	switch status {
+	case ArticleDraft, ArticleScheduled, ArticlePublished, ArticleArchived:
+		return true
+	}
+	return false
+}
+
+// resolvePublishing 根据请求中的 status / published_at 和文章当前的状态计算新的状态和发布时间
+// status 为空时保持当前状态（新文章为草稿）
+func resolvePublishing(article Article, status string, publishedAt *time.Time, now time.Time) (string, *time.Time, error) {
+	if status == "" {
+		status = article.Status
+	}
+	if status == "" {
+		status = ArticleDraft
+	}
+	if !validStatus(status) {
+		return "", nil, errors.New("status must be one of draft, scheduled, published, archived")
+	}
+	now = now.UTC()
+	if publishedAt != nil {
+		t := publishedAt.UTC()
+		publishedAt = &t
+	}
+
+	switch status {
+	case ArticleDraft:
+		return status, nil, nil
+	case ArticleScheduled:
+		if publishedAt == nil && article.Status == ArticleScheduled {
+			// 保持原定的发布时间；已经到期但后台任务还没处理时直接发布
+			publishedAt = article.PublishedAt
+			if publishedAt != nil && !publishedAt.After(now) {
+				return ArticlePublished, publishedAt, nil
+			}
+		}
+		if publishedAt == nil || !publishedAt.After(now) {
+			return "", nil, errors.New("scheduled articles need a published_at in the future")
+		}
+		return status, publishedAt, nil
+	default:
+		// 已发布和归档：未指定时保留原来的发布时间，草稿或提前发布的定时文章从现在开始
+		if publishedAt != nil && publishedAt.After(now) {
+			return "", nil, errors.New("published_at is in the future, use status scheduled")
+		}
+		if publishedAt == nil {
+			publishedAt = article.PublishedAt
+		}
+		if publishedAt == nil || publishedAt.After(now) {
+			publishedAt = &now
+		}
+		return status, publishedAt, nil
+	}
+}
+
+// visibleCondition 调用者能看到的文章的 SQL 条件：匿名用户只能看到已发布的文章，登录用户还能看到自己的文章，
+// 管理员能看到所有文章（与 canView 的规则一致）
+func visibleCondition(claims *Claims) (string, []interface{}) {
+	if claims == nil {
+		return "articles.status = ?", []interface{}{ArticlePublished}
+	}
+	if claims.Role == RoleAdmin {
+		return "1 = 1", nil
+	}
+	return "(articles.status = ? OR articles.author_id = ?)", []interface{}{ArticlePublished, claims.UserID}
+}
+
+// visibleArticles 把查询限定在调用者能看到的文章
+func visibleArticles(query *gorm.DB, claims *Claims) *gorm.DB {
+	condition, args := visibleCondition(claims)
+	return query.Where(condition, args...)
+}
+
+// canView 已发布的文章所有人可见，其他状态只有作者本人和管理员可见
+func canView(claims *Claims, article Article) bool {
+	return article.Status == ArticlePublished || (claims != nil && canModify(claims, article))
+}
+
+// findVisibleArticle 与 findArticle 相同，但调用者看不到的文章也返回 404
+func findVisibleArticle(c *gin.Context, id string, claims *Claims) (Article, bool) {
+	article, ok := findArticle(c, id)
+	if ok && !canView(claims, article) {
+		fail(c, 404, "Article not found")
+		return article, false
+	}
+	return article, ok
+}
+
+// publishDue 把到期的定时文章改为已发布，返回发布的数量
+func publishDue(now time.Time) (int64, error) {
+	result := db.Model(&Article{}).
+		Where("status = ? AND published_at <= ?", ArticleScheduled, now.UTC()).
+		Update("status", ArticlePublished)
+	return result.RowsAffected, result.Error
+}
+
+// startPublisher 启动后台 goroutine，定期发布到期的定时文章
+func startPublisher(ctx context.Context) {
+	publish := func(now time.Time) {
+		n, err := publishDue(now)
+		if err != nil {
+			log.Println("Error publishing scheduled articles:", err)
+		} else if n > 0 {
+			log.Printf("Published %d scheduled article(s)", n)
+		}
+	}
+
+	go func() {
+		// 启动时先处理停机期间到期的文章
+		publish(time.Now())
+
+		ticker := time.NewTicker(publishInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				publish(now)
+			}
+		}
+	}()
+}
+
+// ===== API 处理器 =====
+
+// GetMyArticles 获取当前用户自己的文章（包括草稿和定时文章）
+// GET /api/articles/mine?status=draft&page=1&limit=10
+func GetMyArticles(c *gin.Context) {
+	var articles []Article
+	var total int64
+
+	pageNum, pageSize := paginate(c)
+	offset := (pageNum - 1) * pageSize
+
+	query := db.Model(&Article{}).Where("author_id = ?", currentUser(c).UserID)
+	if status := c.Query("status"); status != "" {
+		if !validStatus(status) {
+			fail(c, 400, "status must be one of draft, scheduled, published, archived")
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	query.Session(&gorm.Session{}).Count(&total)
+
+	result := query.Preload("Category").Preload("Tags").
+		Offset(offset).Limit(pageSize).Order("updated_at DESC").Find(&articles)
+	if result.Error != nil {
+		fail(c, 500, "Failed to retrieve articles")
+		return
+	}
+
+	attachCommentCounts(articles)
+
+	success(c, gin.H{
+		"articles": articles,
+		"total":    total,
+		"page":     pageNum,
+		"limit":    pageSize,
+	}, "Success")
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===== 修订历史 =====
+
+// ArticleRevision 文章的一个修订：创建或每次更新后文章的完整快照
+// Revision 是文章内的序号，从 1 开始；恢复旧修订时生成新的修订，RestoredFrom 记录恢复自哪个修订
+type ArticleRevision struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ArticleID    uint      `gorm:"not null;index:idx_article_revisions_revision,priority:1" json:"article_id"`
+	Revision     int       `gorm:"not null;index:idx_article_revisions_revision,priority:2" json:"revision"`
+	Title        string    `gorm:"not null" json:"title"`
+	Content      string    `gorm:"not null" json:"content,omitempty"`
+	Category     string    `json:"category"`
+	Tags         []string  `gorm:"type:text;serializer:json" json:"tags"`
+	Status       string    `json:"status"`
+	EditorID     uint      `gorm:"index" json:"editor_id"`
+	Editor       string    `json:"editor"`
+	RestoredFrom *int      `json:"restored_from"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// diffLine 行级 diff 中的一行，op 为 equal / insert / delete
+// old_line / new_line 是该行在旧、新内容中的行号（从 1 开始）
+type diffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// 超过这个规模（行数乘积）时不再计算最长公共子序列，直接整体替换
+const maxDiffCells = 4000000
+
+// newRevision 返回记录了编辑者的修订，内容由 recordRevision 填充
+func newRevision(claims *Claims) ArticleRevision {
+	return ArticleRevision{EditorID: claims.UserID, Editor: claims.Username}
+}
+
+// recordRevision 在事务中读取文章的当前状态，保存为下一个修订；与最新修订相同时跳过
+func recordRevision(tx *gorm.DB, articleID uint, revision ArticleRevision) error {
+	var article Article
+	if err := tx.Preload("Category").Preload("Tags").First(&article, articleID).Error; err != nil {
+		return err
+	}
+
+	// 调用前事务已经写过文章，持有 SQLite 的写锁，其他事务不会同时分配同一个序号
+	var latest ArticleRevision
+	err := tx.Where("article_id = ?", articleID).Order("revision DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	revision.ArticleID = article.ID
+	revision.Revision = latest.Revision + 1
+	revision.Title = article.Title
+	revision.Content = article.Content
+	revision.Status = article.Status
+	revision.Category = ""
+	if article.Category != nil {
+		revision.Category = article.Category.Name
+	}
+	revision.Tags = make([]string, 0, len(article.Tags))
+	for _, tag := range article.Tags {
+		revision.Tags = append(revision.Tags, tag.Name)
+	}
+
+	// 内容与最新修订完全相同（例如只改了浏览数，或清除本来就没有的分类）时不产生新修订
+	if latest.ID != 0 && sameSnapshot(latest, revision) {
+		return nil
+	}
+	return tx.Create(&revision).Error
+}
+
+// sameSnapshot 判断两个修订记录的文章内容（标题、正文、分类、标签和状态）是否相同
+func sameSnapshot(a, b ArticleRevision) bool {
+	if a.Title != b.Title || a.Content != b.Content || a.Category != b.Category || a.Status != b.Status {
+		return false
+	}
+	if len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines 按行拆分内容，空内容没有任何行
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines 基于最长公共子序列计算两段文本的行级 diff
+// 先去掉相同的开头和结尾，只对中间变化的部分做动态规划
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []diffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, diffLine{Op: "equal", Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+
+	oldMid, newMid := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(oldMid), len(newMid)
+	i, j := 0, 0
+	if n > 0 && m > 0 && n*m <= maxDiffCells {
+		// lcs[i][j] 为 oldMid[i:] 与 newMid[j:] 的最长公共子序列长度
+		lcs := make([][]int32, n+1)
+		for k := range lcs {
+			lcs[k] = make([]int32, m+1)
+		}
+		for x := n - 1; x >= 0; x-- {
+			for y := m - 1; y >= 0; y-- {
+				if oldMid[x] == newMid[y] {
+					lcs[x][y] = lcs[x+1][y+1] + 1
+				} else if lcs[x+1][y] >= lcs[x][y+1] {
+					lcs[x][y] = lcs[x+1][y]
+				} else {
+					lcs[x][y] = lcs[x][y+1]
+				}
+			}
+		}
+		for i < n && j < m {
+			switch {
+			case oldMid[i] == newMid[j]:
+				lines = append(lines, diffLine{Op: "equal", Text: oldMid[i], OldLine: prefix + i + 1, NewLine: prefix + j + 1})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lines = append(lines, diffLine{Op: "delete", Text: oldMid[i], OldLine: prefix + i + 1})
+				i++
+			default:
+				lines = append(lines, diffLine{Op: "insert", Text: newMid[j], NewLine: prefix + j + 1})
+				j++
+			}
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, diffLine{Op: "delete", Text: oldMid[i], OldLine: prefix + i + 1})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, diffLine{Op: "insert", Text: newMid[j], NewLine: prefix + j + 1})
+	}
+
+	for k := 0; k < suffix; k++ {
+		oldIndex, newIndex := len(a)-suffix+k, len(b)-suffix+k
+		lines = append(lines, diffLine{Op: "equal", Text: a[oldIndex], OldLine: oldIndex + 1, NewLine: newIndex + 1})
+	}
+
+	if lines == nil {
+		lines = []diffLine{}
+	}
+	return lines
+}
+
+// fieldChanges 比较两个修订中除正文以外的字段，只返回发生变化的字段
+func fieldChanges(from, to ArticleRevision) gin.H {
+	changes := gin.H{}
+	if from.Title != to.Title {
+		changes["title"] = gin.H{"from": from.Title, "to": to.Title}
+	}
+	if from.Category != to.Category {
+		changes["category"] = gin.H{"from": from.Category, "to": to.Category}
+	}
+	if strings.Join(from.Tags, "\x00") != strings.Join(to.Tags, "\x00") {
+		changes["tags"] = gin.H{"from": from.Tags, "to": to.Tags}
+	}
+	if from.Status != to.Status {
+		changes["status"] = gin.H{"from": from.Status, "to": to.Status}
+	}
+	return changes
+}
+
+// findRevisionArticle 查找文章并检查修订历史的权限：只有作者本人和管理员可以查看和恢复修订
+func findRevisionArticle(c *gin.Context) (Article, bool) {
+	claims := currentUser(c)
+	article, ok := findVisibleArticle(c, c.Param("id"), claims)
+	if !ok {
+		return article, false
+	}
+	if !canModify(claims, article) {
+		fail(c, 403, "Only the author or an admin can access revisions")
+		return article, false
+	}
+	return article, true
+}
+
+// findRevision 按文章内的序号查找修订，不存在时返回 404
+func findRevision(c *gin.Context, articleID uint, number string) (ArticleRevision, bool) {
+	var revision ArticleRevision
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		fail(c, 400, "Invalid revision number")
+		return revision, false
+	}
+
+	err = db.Where("article_id = ? AND revision = ?", articleID, n).First(&revision).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, 404, "Revision not found")
+		} else {
+			fail(c, 500, "Failed to retrieve revision")
+		}
+		return revision, false
+	}
+	return revision, true
+}
+
+// ===== 修订 API =====
+
+// GetRevisions 获取文章的修订列表（不含正文），最新的在前
+// GET /api/articles/:id/revisions
+func GetRevisions(c *gin.Context) {
+	article, ok := findRevisionArticle(c)
+	if !ok {
+		return
+	}
+
+	var revisions []ArticleRevision
+	err := db.Omit("content").
+		Where("article_id = ?", article.ID).
+		Order("revision DESC").
+		Find(&revisions).Error
+	if err != nil {
+		fail(c, 500, "Failed to retrieve revisions")
+		return
+	}
+
+	if revisions == nil {
+		revisions = []ArticleRevision{}
+	}
+	success(c, revisions, "Success")
+}
+
+// GetRevision 获取单个修订的完整内容
+// GET /api/articles/:id/revisions/:rev
+func GetRevision(c *gin.Context) {
+	article, ok := findRevisionArticle(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := findRevision(c, article.ID, c.Param("rev"))
+	if !ok {
+		return
+	}
+	success(c, revision, "Success")
+}
+
+// DiffRevisions 比较两个修订：正文按行 diff，标题、分类、标签和状态列出变化前后的值
+// to 默认为最新修订，from 默认为 to 的前一个修订；from=0 表示与空文章比较
+// GET /api/articles/:id/revisions/diff?from=1&to=3
+func DiffRevisions(c *gin.Context) {
+	article, ok := findRevisionArticle(c)
+	if !ok {
+		return
+	}
+
+	var to ArticleRevision
+	if c.Query("to") == "" {
+		err := db.Where("article_id = ?", article.ID).Order("revision DESC").First(&to).Error
+		if err != nil {
+			fail(c, 404, "Revision not found")
+			return
+		}
+	} else if to, ok = findRevision(c, article.ID, c.Query("to")); !ok {
+		return
+	}
+
+	from := ArticleRevision{Tags: []string{}}
+	fromNumber := c.DefaultQuery("from", strconv.Itoa(to.Revision-1))
+	if fromNumber != "0" {
+		if from, ok = findRevision(c, article.ID, fromNumber); !ok {
+			return
+		}
+	}
+
+	lines := diffLines(splitLines(from.Content), splitLines(to.Content))
+	added, removed := 0, 0
+	for _, line := range lines {
+		switch line.Op {
+		case "insert":
+			added++
+		case "delete":
+			removed++
+		}
+	}
+
+	success(c, gin.H{
+		"from":    from.Revision,
+		"to":      to.Revision,
+		"changes": fieldChanges(from, to),
+		"added":   added,
+		"removed": removed,
+		"lines":   lines,
+	}, "Success")
+}
+
+// RestoreRevision 把文章恢复到旧修订的标题、正文、分类和标签，并记录为新的修订（发布状态不变）
+// POST /api/articles/:id/revisions/:rev/restore
+func RestoreRevision(c *gin.Context) {
+	article, ok := findRevisionArticle(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := findRevision(c, article.ID, c.Param("rev"))
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{"title": revision.Title, "content": revision.Content}
+	tags := revision.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	restored := newRevision(currentUser(c))
+	restored.RestoredFrom = &revision.Revision
+
+	if err := saveArticle(&article, updates, &revision.Category, &tags, restored); err != nil {
+		log.Println("Error restoring article revision:", err)
+		fail(c, 500, "Failed to restore revision")
+		return
+	}
+
+	sendReloadedArticle(c, article.ID, fmt.Sprintf("Article restored to revision %d", revision.Revision))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formatDiff 把 diff 写成紧凑的形式：=旧行号,新行号 文本 / -旧行号 文本 / +新行号 文本
+func formatDiff(lines []diffLine) []string {
+	out := []string{}
+	for _, line := range lines {
+		switch line.Op {
+		case "equal":
+			out = append(out, fmt.Sprintf("=%d,%d %s", line.OldLine, line.NewLine, line.Text))
+		case "delete":
+			out = append(out, fmt.Sprintf("-%d %s", line.OldLine, line.Text))
+		case "insert":
+			out = append(out, fmt.Sprintf("+%d %s", line.NewLine, line.Text))
+		}
+	}
+	return out
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want []string
+	}{
+		{"both empty", "", "", []string{}},
+		{"identical", "a\nb\nc", "a\nb\nc", []string{"=1,1 a", "=2,2 b", "=3,3 c"}},
+		{"insert into empty", "", "x\ny", []string{"+1 x", "+2 y"}},
+		{"delete everything", "x\ny", "", []string{"-1 x", "-2 y"}},
+		{"replace middle line", "a\nb\nc", "a\nx\nc", []string{"=1,1 a", "-2 b", "+2 x", "=3,3 c"}},
+		{"insert middle line", "a\nc", "a\nb\nc", []string{"=1,1 a", "+2 b", "=2,3 c"}},
+		{"delete first append last", "a\nb\nc\nd", "b\nc\nd\ne", []string{"-1 a", "=2,1 b", "=3,2 c", "=4,3 d", "+4 e"}},
+		{"swap prefers delete first", "x\ny", "y\nx", []string{"-1 x", "=2,1 y", "+2 x"}},
+		{"repeated lines keep common suffix", "a\na\nb", "a\nb\nb", []string{"=1,1 a", "-2 a", "+2 b", "=3,3 b"}},
+		{"crlf and trailing newline", "a\r\nb\r\n", "a\nb", []string{"=1,1 a", "=2,2 b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDiff(diffLines(splitLines(tt.old), splitLines(tt.new)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines(%q, %q) =\n%s\nwant\n%s", tt.old, tt.new, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffLinesReconstructsBothSides(t *testing.T) {
+	pairs := [][2]string{
+		{"a\nb\nc\nd\ne", "a\nc\nd\nx\ne\nf"},
+		{"one\ntwo\nthree", "zero\none\nthree\nfour"},
+		{"x\nx\nx\ny", "y\nx\nx"},
+	}
+
+	for _, pair := range pairs {
+		a, b := splitLines(pair[0]), splitLines(pair[1])
+		var oldSide, newSide []string
+		for _, line := range diffLines(a, b) {
+			if line.Op != "insert" {
+				oldSide = append(oldSide, line.Text)
+				if a[line.OldLine-1] != line.Text {
+					t.Errorf("old line %d is %q, diff says %q", line.OldLine, a[line.OldLine-1], line.Text)
+				}
+			}
+			if line.Op != "delete" {
+				newSide = append(newSide, line.Text)
+				if b[line.NewLine-1] != line.Text {
+					t.Errorf("new line %d is %q, diff says %q", line.NewLine, b[line.NewLine-1], line.Text)
+				}
+			}
+		}
+		if !reflect.DeepEqual(oldSide, a) || !reflect.DeepEqual(newSide, b) {
+			t.Errorf("diff of %q and %q does not reconstruct both sides", pair[0], pair[1])
+		}
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	// 超过 maxDiffCells 时不计算最长公共子序列，中间部分整体删除再插入
+	var a, b []string
+	for i := 0; i < 2100; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	a = append([]string{"same"}, a...)
+	b = append([]string{"same"}, b...)
+
+	lines := diffLines(a, b)
+	if len(lines) != 1+2100+2100 {
+		t.Fatalf("got %d diff lines, want %d", len(lines), 1+2100+2100)
+	}
+	if lines[0].Op != "equal" || lines[1].Op != "delete" || lines[2101].Op != "insert" {
+		t.Errorf("unexpected diff layout: %v %v %v", lines[0], lines[1], lines[2101])
+	}
+}
+
+func TestSameSnapshot(t *testing.T) {
+	base := ArticleRevision{Title: "t", Content: "c", Category: "go", Tags: []string{"a", "b"}, Status: ArticlePublished}
+
+	same := base
+	same.Tags = []string{"a", "b"}
+	same.Revision, same.EditorID = 7, 3
+	if !sameSnapshot(base, same) {
+		t.Error("revisions differing only in number and editor should be the same snapshot")
+	}
+
+	changes := map[string]func(*ArticleRevision){
+		"title":    func(r *ArticleRevision) { r.Title = "other" },
+		"content":  func(r *ArticleRevision) { r.Content = "other" },
+		"category": func(r *ArticleRevision) { r.Category = "" },
+		"tags":     func(r *ArticleRevision) { r.Tags = []string{"a"} },
+		"tag name": func(r *ArticleRevision) { r.Tags = []string{"a", "c"} },
+		"status":   func(r *ArticleRevision) { r.Status = ArticleDraft },
+	}
+	for name, change := range changes {
+		changed := base
+		changed.Tags = append([]string(nil), base.Tags...)
+		change(&changed)
+		if sameSnapshot(base, changed) {
+			t.Errorf("changing %s should make a different snapshot", name)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===== 全文搜索（SQLite FTS5） =====
+//
+// articles_fts 是 articles 表的外部内容索引，由触发器保持同步，二者都由迁移 0007_articles_fts 建立。
+// FTS5 需要使用 sqlite_fts5 构建标签编译 go-sqlite3：
+//
+//	go run -tags sqlite_fts5 .
+//
+// 未启用时拒绝启动，除非设置 BLOG_SEARCH_FALLBACK=like 明确允许退回到 LIKE 搜索。
+
+// 是否可以使用 FTS5 索引
+var ftsEnabled bool
+
+// 没有 FTS5 时是否允许退回到 LIKE 搜索（前导通配符，需要全表扫描）
+var searchFallback = os.Getenv("BLOG_SEARCH_FALLBACK") == "like"
+
+// 高亮标记，前端先转义 HTML 再把标记替换回来
+const (
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+)
+
+// bm25 权重：标题 > 作者 > 正文
+const bm25Weights = "10.0, 1.0, 2.0"
+
+// SearchResult 搜索结果，在文章基础上附带相关度和高亮片段
+type SearchResult struct {
+	Article
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+// ===== 初始化全文索引 =====
+
+// fts5Available 当前构建的 SQLite 是否包含 FTS5 模块
+func fts5Available(tx *gorm.DB) bool {
+	var used int
+	err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error
+	return err == nil && used == 1
+}
+
+// initSearch 检查全文索引是否可用；索引和触发器由迁移 0007_articles_fts 建立
+func initSearch() error {
+	exists := db.Migrator().HasTable("articles_fts")
+	available := fts5Available(db)
+
+	switch {
+	case exists && available:
+		ftsEnabled = true
+	case exists:
+		// 触发器引用了 fts5 模块，没有 FTS5 时写入文章都会失败
+		return errors.New("database has the articles_fts index but this binary was built without FTS5, build with -tags sqlite_fts5")
+	case !searchFallback:
+		return errors.New("FTS5 not available: build with -tags sqlite_fts5, or set BLOG_SEARCH_FALLBACK=like to use LIKE search")
+	default:
+		log.Println("FTS5 not available, BLOG_SEARCH_FALLBACK=like is set, falling back to LIKE search")
+	}
+	return nil
+}
+
+// buildMatchQuery 把用户输入转换成安全的 FTS5 查询
+// 支持 "短语查询"、前缀查询 go*，其余词按 AND 组合
+func buildMatchQuery(input string) string {
+	var terms []string
+	rest := input
+
+	for {
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			break
+		}
+
+		// 短语查询
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				rest = rest[1:]
+				continue
+			}
+			if phrase := strings.TrimSpace(rest[1 : end+1]); phrase != "" {
+				terms = append(terms, quoteTerm(phrase))
+			}
+			rest = rest[end+2:]
+			continue
+		}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+
+		// 前缀查询
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.Trim(word, `*"`)
+		if word == "" {
+			continue
+		}
+		if prefix {
+			terms = append(terms, quoteTerm(word)+"*")
+		} else {
+			terms = append(terms, quoteTerm(word))
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// quoteTerm 用双引号包裹查询词，避免 FTS5 语法注入
+func quoteTerm(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+// SearchArticles 全文搜索文章（BM25 排序，返回高亮片段）
+// GET /api/search?q=keyword&page=1&limit=10
+func SearchArticles(c *gin.Context) {
+	keyword := strings.TrimSpace(c.Query("q"))
+
+	if keyword == "" {
+		fail(c, 400, "Search keyword is required")
+		return
+	}
+
+	pageNum, pageSize := paginate(c)
+	offset := (pageNum - 1) * pageSize
+
+	var results []SearchResult
+	var total int64
+
+	if ftsEnabled {
+		match := buildMatchQuery(keyword)
+		if match == "" {
+			fail(c, 400, "Search keyword is required")
+			return
+		}
+
+		// 只返回调用者能看到的文章（匿名用户只能搜到已发布的文章）
+		visible, args := visibleCondition(optionalUser(c))
+
+		countArgs := append([]interface{}{match}, args...)
+		err := db.Raw(`
+			SELECT COUNT(*) FROM articles_fts
+			JOIN articles ON articles.id = articles_fts.rowid
+			WHERE articles_fts MATCH ? AND `+visible, countArgs...).Scan(&total).Error
+		if err != nil {
+			log.Println("Error counting search results:", err)
+			fail(c, 500, "Failed to search articles")
+			return
+		}
+
+		queryArgs := []interface{}{highlightOpen, highlightClose, highlightOpen, highlightClose, match}
+		queryArgs = append(append(queryArgs, args...), pageSize, offset)
+		err = db.Raw(`
+			SELECT articles.*,
+				bm25(articles_fts, `+bm25Weights+`) AS rank,
+				highlight(articles_fts, 0, ?, ?) AS title_highlight,
+				snippet(articles_fts, 1, ?, ?, '…', 24) AS snippet
+			FROM articles_fts
+			JOIN articles ON articles.id = articles_fts.rowid
+			WHERE articles_fts MATCH ? AND `+visible+`
+			ORDER BY rank
+			LIMIT ? OFFSET ?`,
+			queryArgs...,
+		).Scan(&results).Error
+
+		if err != nil {
+			log.Println("Error searching articles:", err)
+			fail(c, 500, "Failed to search articles")
+			return
+		}
+	} else {
+		pattern := "%" + keyword + "%"
+		where := "(title LIKE ? OR content LIKE ? OR author LIKE ?)"
+		claims := optionalUser(c)
+		visibleArticles(db.Model(&Article{}), claims).Where(where, pattern, pattern, pattern).Count(&total)
+
+		var articles []Article
+		err := visibleArticles(db, claims).Where(where, pattern, pattern, pattern).
+			Order("created_at DESC").
+			Offset(offset).
+			Limit(pageSize).
+			Find(&articles).Error
+		if err != nil {
+			fail(c, 500, "Failed to search articles")
+			return
+		}
+		for _, article := range articles {
+			results = append(results, SearchResult{Article: article, TitleHighlight: article.Title})
+		}
+	}
+
+	if results == nil {
+		results = []SearchResult{}
+	}
+
+	// 原生 SQL 查询不会加载关联，按 ID 补齐分类和标签
+	if err := loadTaxonomy(results); err != nil {
+		log.Println("Error loading search result taxonomy:", err)
+	}
+
+	success(c, gin.H{
+		"articles": results,
+		"total":    total,
+		"page":     pageNum,
+		"limit":    pageSize,
+	}, "Search completed")
+}
+
+// loadTaxonomy 为搜索结果加载分类和标签
+func loadTaxonomy(results []SearchResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+
+	var articles []Article
+	if err := db.Preload("Category").Preload("Tags").Find(&articles, ids).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[uint]Article, len(articles))
+	for _, article := range articles {
+		byID[article.ID] = article
+	}
+	for i := range results {
+		loaded := byID[results[i].ID]
+		results[i].Category = loaded.Category
+		results[i].Tags = loaded.Tags
+	}
+	return nil
+}
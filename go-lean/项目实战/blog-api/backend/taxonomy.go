@@ -0,0 +1,462 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===== 分类与标签模型 =====
+
+// Category 文章分类，slug 唯一，"Go" 和 "go" 视为同一分类
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;not null" json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Tag 文章标签，与文章多对多关联（article_tags 表）
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;not null" json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TagCount 标签及其文章数
+type TagCount struct {
+	Tag
+	ArticleCount int64 `json:"article_count"`
+}
+
+// CategoryCount 分类及其文章数
+type CategoryCount struct {
+	Category
+	ArticleCount int64 `json:"article_count"`
+}
+
+type NameInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type MergeInput struct {
+	Into uint `json:"into" binding:"required"`
+}
+
+var (
+	errSlugTaken = errors.New("slug already taken")
+	errMergeSelf = errors.New("cannot merge a tag into itself")
+)
+
+// ===== 工具函数 =====
+
+// slugify 生成 URL 友好的标识：小写，空白和分隔符变成 "-"，去掉其他标点
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '+' || r == '#':
+			b.WriteRune(r)
+			dash = false
+		case unicode.IsSpace(r) || r == '-' || r == '_' || r == '/' || r == '.':
+			if b.Len() > 0 && !dash {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// resolveCategory 按 slug 查找分类，不存在时创建；name 为空返回 nil
+func resolveCategory(tx *gorm.DB, name string) (*Category, error) {
+	name = strings.TrimSpace(name)
+	slug := slugify(name)
+	if slug == "" {
+		return nil, nil
+	}
+
+	category := Category{Name: name, Slug: slug}
+	if err := tx.Where(Category{Slug: slug}).FirstOrCreate(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// resolveTags 按 slug 查找标签，不存在时创建，重复的标签只保留一个
+func resolveTags(tx *gorm.DB, names []string) ([]Tag, error) {
+	tags := []Tag{}
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		tag := Tag{Name: name, Slug: slug}
+		if err := tx.Where(Tag{Slug: slug}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// splitList 解析逗号分隔的查询参数
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// tagSlugs 把标签名称转换为 slug，去掉重复和空的 slug（"go,Go" 只算一个标签）
+func tagSlugs(names []string) []string {
+	var slugs []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		slug := slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		slugs = append(slugs, slug)
+	}
+	return slugs
+}
+
+// filterByTags 按标签过滤文章，slugs 必须已经去重，mode 为 all 时必须包含全部标签，否则包含任意一个即可
+func filterByTags(query *gorm.DB, slugs []string, mode string) *gorm.DB {
+	sub := db.Table("article_tags").
+		Select("article_tags.article_id").
+		Joins("JOIN tags ON tags.id = article_tags.tag_id").
+		Where("tags.slug IN ?", slugs)
+
+	if mode == "all" {
+		sub = sub.Group("article_tags.article_id").Having("COUNT(DISTINCT tags.id) = ?", len(slugs))
+	}
+
+	return query.Where("articles.id IN (?)", sub)
+}
+
+// requireAdmin 标签和分类的管理操作只允许管理员执行
+func requireAdmin(c *gin.Context) bool {
+	if currentUser(c).Role != RoleAdmin {
+		fail(c, 403, "Admin role required")
+		return false
+	}
+	return true
+}
+
+// ===== 标签 API =====
+
+// GetTags 获取所有标签及已发布的文章数
+// GET /api/tags
+func GetTags(c *gin.Context) {
+	var tags []TagCount
+	result := db.Model(&Tag{}).
+		Select("tags.*, COUNT(articles.id) AS article_count").
+		Joins("LEFT JOIN article_tags ON article_tags.tag_id = tags.id").
+		Joins("LEFT JOIN articles ON articles.id = article_tags.article_id AND articles.status = ?", ArticlePublished).
+		Group("tags.id").
+		Order("article_count DESC, tags.name").
+		Scan(&tags)
+
+	if result.Error != nil {
+		fail(c, 500, "Failed to retrieve tags")
+		return
+	}
+
+	if tags == nil {
+		tags = []TagCount{}
+	}
+	success(c, tags, "Success")
+}
+
+// RenameTag 重命名标签
+// PUT /api/tags/:id
+func RenameTag(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var input NameInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	slug := slugify(input.Name)
+	if slug == "" {
+		fail(c, 400, "Tag name must contain letters or digits")
+		return
+	}
+
+	var tag Tag
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&tag, c.Param("id")).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		tx.Model(&Tag{}).Where("slug = ? AND id <> ?", slug, tag.ID).Count(&count)
+		if count > 0 {
+			return errSlugTaken
+		}
+
+		return tx.Model(&tag).Updates(Tag{Name: strings.TrimSpace(input.Name), Slug: slug}).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(c, 404, "Tag not found")
+		return
+	}
+	if errors.Is(err, errSlugTaken) {
+		fail(c, 409, "A tag with this name already exists, merge them instead")
+		return
+	}
+	if err != nil {
+		log.Println("Error renaming tag:", err)
+		fail(c, 500, "Failed to rename tag")
+		return
+	}
+
+	success(c, tag, "Tag renamed successfully")
+}
+
+// MergeTag 把标签合并到另一个标签，并删除原标签
+// POST /api/tags/:id/merge
+func MergeTag(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var input MergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	var source, target Tag
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&source, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&target, input.Into).Error; err != nil {
+			return err
+		}
+		if source.ID == target.ID {
+			return errMergeSelf
+		}
+
+		// 已经同时带有两个标签的文章只保留目标标签
+		err := tx.Exec(`
+			INSERT OR IGNORE INTO article_tags (article_id, tag_id)
+			SELECT article_id, ? FROM article_tags WHERE tag_id = ?`,
+			target.ID, source.ID,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM article_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&source).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(c, 404, "Tag not found")
+		return
+	}
+	if errors.Is(err, errMergeSelf) {
+		fail(c, 400, "Cannot merge a tag into itself")
+		return
+	}
+	if err != nil {
+		log.Println("Error merging tags:", err)
+		fail(c, 500, "Failed to merge tags")
+		return
+	}
+
+	success(c, target, "Tags merged successfully")
+}
+
+// ===== 分类 API =====
+
+// GetCategories 获取所有分类及已发布的文章数
+// GET /api/categories
+func GetCategories(c *gin.Context) {
+	var categories []CategoryCount
+	result := db.Model(&Category{}).
+		Select("categories.*, COUNT(articles.id) AS article_count").
+		Joins("LEFT JOIN articles ON articles.category_id = categories.id AND articles.status = ?", ArticlePublished).
+		Group("categories.id").
+		Order("categories.name").
+		Scan(&categories)
+
+	if result.Error != nil {
+		fail(c, 500, "Failed to retrieve categories")
+		return
+	}
+
+	if categories == nil {
+		categories = []CategoryCount{}
+	}
+	success(c, categories, "Success")
+}
+
+// CreateCategory 创建分类，同名（slug 相同）的分类已存在时直接返回
+// POST /api/categories
+func CreateCategory(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var input NameInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	category, err := resolveCategory(db, input.Name)
+	if err != nil {
+		log.Println("Error creating category:", err)
+		fail(c, 500, "Failed to create category")
+		return
+	}
+	if category == nil {
+		fail(c, 400, "Category name must contain letters or digits")
+		return
+	}
+
+	success(c, category, "Category created successfully")
+}
+
+// RenameCategory 重命名分类
+// PUT /api/categories/:id
+func RenameCategory(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var input NameInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	slug := slugify(input.Name)
+	if slug == "" {
+		fail(c, 400, "Category name must contain letters or digits")
+		return
+	}
+
+	var category Category
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, c.Param("id")).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		tx.Model(&Category{}).Where("slug = ? AND id <> ?", slug, category.ID).Count(&count)
+		if count > 0 {
+			return errSlugTaken
+		}
+
+		return tx.Model(&category).Updates(Category{Name: strings.TrimSpace(input.Name), Slug: slug}).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(c, 404, "Category not found")
+		return
+	}
+	if errors.Is(err, errSlugTaken) {
+		fail(c, 409, "A category with this name already exists")
+		return
+	}
+	if err != nil {
+		log.Println("Error renaming category:", err)
+		fail(c, 500, "Failed to rename category")
+		return
+	}
+
+	success(c, category, "Category renamed successfully")
+}
+
+// DeleteCategory 删除分类，原分类下的文章变为未分类
+// DELETE /api/categories/:id
+func DeleteCategory(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var category Category
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Article{}).Where("category_id = ?", category.ID).Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(c, 404, "Category not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error deleting category:", err)
+		fail(c, 500, "Failed to delete category")
+		return
+	}
+
+	success(c, gin.H{"id": category.ID}, "Category deleted successfully")
+}
+
+// ===== 旧数据迁移 =====
+
+// migrateLegacyCategories 把旧版 articles.category 文本列迁移为 Category 关联
+func migrateLegacyCategories(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn("articles", "category") {
+		return nil
+	}
+
+	var rows []struct {
+		ID       uint
+		Category string
+	}
+	err := tx.Raw("SELECT id, category FROM articles WHERE category_id IS NULL AND category IS NOT NULL AND category <> ''").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		category, err := resolveCategory(tx, row.Category)
+		if err != nil {
+			return err
+		}
+		if category == nil {
+			continue
+		}
+		if err := tx.Model(&Article{}).Where("id = ?", row.ID).Update("category_id", category.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ===== 浏览计数 =====
+//
+// 浏览不再每次直接写数据库：viewCounter 在内存中按文章和日期累加，
+// 后台任务定期用 view_count = view_count + ? 批量写入，同时累加到按天统计的 article_views_daily 表。
+// 服务停止时会把尚未写入的计数全部写入。
+
+// ArticleViewDaily 文章每天的浏览数，日期为 UTC 的 YYYY-MM-DD
+type ArticleViewDaily struct {
+	ArticleID uint   `gorm:"primaryKey;autoIncrement:false" json:"article_id"`
+	Day       string `gorm:"primaryKey;index" json:"day"`
+	Views     int64  `gorm:"not null;default:0" json:"views"`
+}
+
+func (ArticleViewDaily) TableName() string {
+	return "article_views_daily"
+}
+
+// 写入数据库的间隔
+const viewFlushInterval = 10 * time.Second
+
+// 去重时最多记住的访客数，超过后新访客不再去重，避免占用过多内存
+const maxSeenVisitors = 100000
+
+// 同一访客在这段时间内重复浏览同一篇文章只计一次，通过环境变量 BLOG_VIEW_DEDUP_WINDOW 设置（如 30m），默认不去重
+var viewDedupWindow = parseDedupWindow(os.Getenv("BLOG_VIEW_DEDUP_WINDOW"))
+
+func parseDedupWindow(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		log.Printf("Invalid BLOG_VIEW_DEDUP_WINDOW %q, view deduplication disabled", value)
+		return 0
+	}
+	return window
+}
+
+// viewKey 待写入计数的键：文章和浏览发生的日期
+type viewKey struct {
+	ArticleID uint
+	Day       string
+}
+
+// viewCounter 浏览计数的内存缓冲
+type viewCounter struct {
+	mu      sync.Mutex
+	flushMu sync.Mutex // 写入数据库期间持有，重置浏览数时也持有，二者不会交错
+	counts  map[viewKey]int64
+	seen    map[string]time.Time // 访客和文章 -> 上次计数的时间
+	window  time.Duration
+	done    chan struct{} // 停止后最后一次写入完成时关闭
+}
+
+var views = newViewCounter(viewDedupWindow)
+
+func newViewCounter(window time.Duration) *viewCounter {
+	return &viewCounter{
+		counts: map[viewKey]int64{},
+		seen:   map[string]time.Time{},
+		window: window,
+		done:   make(chan struct{}),
+	}
+}
+
+// visitorID 标识访客：登录用户按用户 ID，匿名访客按 IP 和 User-Agent
+func visitorID(c *gin.Context) string {
+	if claims := optionalUser(c); claims != nil {
+		return "user:" + strconv.FormatUint(uint64(claims.UserID), 10)
+	}
+	return "ip:" + c.ClientIP() + "|" + c.Request.UserAgent()
+}
+
+// record 记录一次浏览，返回是否计数（去重窗口内的重复浏览不计数）
+func (v *viewCounter) record(articleID uint, visitor string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.window > 0 {
+		key := strconv.FormatUint(uint64(articleID), 10) + "|" + visitor
+		last, ok := v.seen[key]
+		if ok && now.Sub(last) < v.window {
+			return false
+		}
+		if ok || len(v.seen) < maxSeenVisitors {
+			v.seen[key] = now
+		}
+	}
+
+	v.counts[viewKey{articleID, now.UTC().Format("2006-01-02")}]++
+	return true
+}
+
+// pendingFor 返回文章尚未写入数据库的浏览数
+func (v *viewCounter) pendingFor(articleID uint) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var n int64
+	for key, count := range v.counts {
+		if key.ArticleID == articleID {
+			n += count
+		}
+	}
+	return n
+}
+
+// discard 丢弃文章尚未写入的浏览数（文章被删除或浏览数被管理员重置时）
+func (v *viewCounter) discard(articleID uint) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for key := range v.counts {
+		if key.ArticleID == articleID {
+			delete(v.counts, key)
+		}
+	}
+}
+
+// reset 重置文章的浏览数：先丢弃尚未写入的计数，再执行 write 把新的浏览数写入数据库
+// 整个过程持有 flushMu，后台写入不会把重置之前的浏览加到重置后的值上
+func (v *viewCounter) reset(articleID uint, write func() error) error {
+	v.flushMu.Lock()
+	defer v.flushMu.Unlock()
+
+	v.discard(articleID)
+	return write()
+}
+
+// flush 把缓冲的计数写入数据库，失败时放回缓冲等待下次写入
+func (v *viewCounter) flush(now time.Time) error {
+	v.flushMu.Lock()
+	defer v.flushMu.Unlock()
+
+	v.mu.Lock()
+	pending := v.counts
+	v.counts = map[viewKey]int64{}
+	for key, last := range v.seen {
+		if now.Sub(last) >= v.window {
+			delete(v.seen, key)
+		}
+	}
+	v.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		totals := map[uint]int64{}
+		for key, count := range pending {
+			totals[key.ArticleID] += count
+
+			// 只为仍然存在的文章累加每日统计
+			err := tx.Exec(`
+				INSERT INTO article_views_daily (article_id, day, views)
+				SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM articles WHERE id = ?)
+				ON CONFLICT (article_id, day) DO UPDATE SET views = views + excluded.views`,
+				key.ArticleID, key.Day, count, key.ArticleID).Error
+			if err != nil {
+				return err
+			}
+		}
+		for id, count := range totals {
+			err := tx.Model(&Article{}).Where("id = ?", id).
+				UpdateColumn("view_count", gorm.Expr("view_count + ?", count)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		v.mu.Lock()
+		for key, count := range pending {
+			v.counts[key] += count
+		}
+		v.mu.Unlock()
+	}
+	return err
+}
+
+// start 启动后台 goroutine 定期写入计数；ctx 取消时写入剩余的计数后关闭 done
+func (v *viewCounter) start(ctx context.Context) {
+	flush := func() {
+		if err := v.flush(time.Now()); err != nil {
+			log.Println("Error flushing view counts:", err)
+		}
+	}
+
+	go func() {
+		defer close(v.done)
+
+		ticker := time.NewTicker(viewFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				flush()
+				return
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+// dailyViews 返回最近 days 天（含今天，UTC）已发布文章每天的浏览数，没有浏览的日期为 0
+func dailyViews(days int, now time.Time) ([]gin.H, error) {
+	today := now.UTC()
+	since := today.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+
+	var rows []struct {
+		Day   string
+		Views int64
+	}
+	err := db.Table("article_views_daily").
+		Select("article_views_daily.day AS day, SUM(article_views_daily.views) AS views").
+		Joins("JOIN articles ON articles.id = article_views_daily.article_id").
+		Where("articles.status = ? AND article_views_daily.day >= ?", ArticlePublished, since).
+		Group("article_views_daily.day").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		byDay[row.Day] = row.Views
+	}
+
+	trend := make([]gin.H, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format("2006-01-02")
+		trend = append(trend, gin.H{"day": day, "views": byDay[day]})
+	}
+	return trend, nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ===== 用户模型 =====
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// 登录令牌有效期
+const sessionTTL = 7 * 24 * time.Hour
+
+type contextKey string
+
+const userIDKey contextKey = "userID"
+
+// ===== 工具函数：令牌生成与哈希 =====
+
+// newToken 生成随机令牌，数据库中只保存它的 SHA-256 哈希
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// currentUserID 返回经 authMiddleware 认证后的用户 ID
+func currentUserID(r *http.Request) int {
+	id, _ := r.Context().Value(userIDKey).(int)
+	return id
+}
+
+// bearerToken 从 Authorization 头中取出 Bearer 令牌
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// ===== 中间件：Bearer 令牌认证 =====
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 注册和登录接口无需认证
+		if r.URL.Path == "/api/auth/register" || r.URL.Path == "/api/auth/login" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// 浏览器的 EventSource 不能设置请求头，事件流允许通过 access_token 参数传递令牌
+		token := bearerToken(r)
+		if token == "" && r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/events") {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token == "" {
+			sendError(w, 401, "Missing bearer token")
+			return
+		}
+
+		var userID int
+		err := db.QueryRow(
+			"SELECT user_id FROM sessions WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP",
+			hashToken(token),
+		).Scan(&userID)
+
+		if err == sql.ErrNoRows {
+			sendError(w, 401, "Invalid or expired token")
+			return
+		} else if err != nil {
+			log.Println("Error checking session:", err)
+			sendError(w, 500, "Failed to verify token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ===== 认证处理器 =====
+
+// POST /api/auth/register - 注册新用户
+func register(w http.ResponseWriter, r *http.Request) {
+	var cred credentials
+	err := json.NewDecoder(r.Body).Decode(&cred)
+	if err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+
+	cred.Username = strings.TrimSpace(cred.Username)
+	if cred.Username == "" {
+		sendError(w, 400, "Username is required")
+		return
+	}
+	if len(cred.Password) < 8 {
+		sendError(w, 400, "Password must be at least 8 characters")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(cred.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Error hashing password:", err)
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", cred.Username).Scan(&exists)
+	if err != nil {
+		log.Println("Error checking username:", err)
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+	if exists {
+		sendError(w, 409, "Username already taken")
+		return
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO users (username, password_hash) VALUES (?, ?)",
+		cred.Username,
+		string(hash),
+	)
+	if err != nil {
+		log.Println("Error inserting user:", err)
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		sendError(w, 500, "Failed to get inserted ID")
+		return
+	}
+
+	inbox, err := createInbox(tx, id)
+	if err != nil {
+		log.Println("Error creating inbox:", err)
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+
+	// 升级前创建的待办项没有所有者，归第一个注册的用户，放入其收件箱
+	_, err = tx.Exec("UPDATE todos SET user_id = ?, list_id = ? WHERE user_id IS NULL", id, inbox)
+	if err != nil {
+		log.Println("Error claiming legacy todos:", err)
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing user:", err)
+		sendError(w, 500, "Failed to register user")
+		return
+	}
+
+	sendJSON(w, 0, "User registered successfully", User{ID: int(id), Username: cred.Username})
+}
+
+// POST /api/auth/login - 登录并获取令牌
+func login(w http.ResponseWriter, r *http.Request) {
+	var cred credentials
+	err := json.NewDecoder(r.Body).Decode(&cred)
+	if err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+
+	var user User
+	var hash string
+	err = db.QueryRow("SELECT id, username, password_hash FROM users WHERE username = ?", strings.TrimSpace(cred.Username)).
+		Scan(&user.ID, &user.Username, &hash)
+
+	if err == sql.ErrNoRows {
+		sendError(w, 401, "Invalid username or password")
+		return
+	} else if err != nil {
+		log.Println("Error querying user:", err)
+		sendError(w, 500, "Failed to log in")
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(cred.Password)) != nil {
+		sendError(w, 401, "Invalid username or password")
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		log.Println("Error generating token:", err)
+		sendError(w, 500, "Failed to log in")
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(sessionTTL).Truncate(time.Second)
+	_, err = db.Exec(
+		"INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashToken(token),
+		user.ID,
+		formatTime(expiresAt),
+	)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		sendError(w, 500, "Failed to log in")
+		return
+	}
+
+	sendJSON(w, 0, "Login successful", map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt,
+		"user":       user,
+	})
+}
+
+// POST /api/auth/logout - 注销当前令牌
+func logout(w http.ResponseWriter, r *http.Request) {
+	_, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(bearerToken(r)))
+	if err != nil {
+		log.Println("Error deleting session:", err)
+		sendError(w, 500, "Failed to log out")
+		return
+	}
+
+	sendJSON(w, 0, "Logged out", nil)
+}
+
+// GET /api/auth/me - 获取当前用户信息
+func getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var user User
+	err := db.QueryRow("SELECT id, username FROM users WHERE id = ?", currentUserID(r)).
+		Scan(&user.ID, &user.Username)
+
+	if err == sql.ErrNoRows {
+		sendError(w, 404, "User not found")
+		return
+	} else if err != nil {
+		log.Println("Error querying user:", err)
+		sendError(w, 500, "Failed to retrieve user")
+		return
+	}
+
+	sendJSON(w, 0, "Success", user)
+}
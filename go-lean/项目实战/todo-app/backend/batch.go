@@ -0,0 +1,352 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ===== 批量操作 =====
+//
+// 所有操作在同一个 sql.Tx 中按顺序执行：
+// atomic 为 true 时任意一个操作失败就回滚整个事务（全部成功或全部不生效）；
+// 否则每个操作放在一个 SAVEPOINT 中，失败的操作只回滚自己，其余操作照常提交。
+
+const maxBatchOperations = 100
+
+type batchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchOperation struct {
+	Op   string          `json:"op"`   // create / update / delete / toggle
+	ID   int             `json:"id"`   // update / delete / toggle 的待办项 ID
+	Todo json.RawMessage `json:"todo"` // create 时为完整的待办项，update 时为 JSON Merge Patch
+}
+
+// batchResult 单个操作的结果，code 为 0 表示成功，否则与单独调用对应接口时的状态码一致
+type batchResult struct {
+	Index   int    `json:"index"`
+	Op      string `json:"op"`
+	ID      int    `json:"id,omitempty"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Todo    *Todo  `json:"todo,omitempty"`
+}
+
+// batchContext 执行批量操作所需的状态
+type batchContext struct {
+	tx     *sql.Tx
+	userID int
+	scope  int // 路由中的清单，0 表示不限定
+
+	events []todoEvent // 提交事务后发布的事件
+}
+
+// ===== 单个操作 =====
+
+// editableList 检查用户能否在清单中新建或修改待办项，与 authorizeListTodos 的规则一致
+func (c *batchContext) editableList(listID int) error {
+	role, archived, err := listRole(c.tx, listID, c.userID)
+	if err != nil {
+		return err
+	}
+	if err := roleError(role, RoleEditor, "List not found"); err != nil {
+		return err
+	}
+	if archived {
+		return &apiError{403, "List is archived"}
+	}
+	return nil
+}
+
+// editableTodo 检查用户能否修改待办项，与 authorizeTodo 的规则一致，返回待办项所在的清单
+func (c *batchContext) editableTodo(todoID int) (int, error) {
+	listID, role, archived, err := todoRole(c.tx, todoID, c.userID)
+	if err != nil {
+		return 0, err
+	}
+	if c.scope != 0 && c.scope != listID {
+		role = ""
+	}
+	if err := roleError(role, RoleEditor, "Todo not found"); err != nil {
+		return 0, err
+	}
+	if archived {
+		return 0, &apiError{403, "List is archived"}
+	}
+	return listID, nil
+}
+
+func (c *batchContext) create(op batchOperation) (*Todo, error) {
+	var todo Todo
+	if err := json.Unmarshal(op.Todo, &todo); err != nil {
+		return nil, &apiError{400, "Invalid todo"}
+	}
+	priority, err := validateTodo(&todo)
+	if err != nil {
+		return nil, &apiError{400, err.Error()}
+	}
+	todo.Priority = priorityName(priority)
+
+	// 与 createTodo 相同：路由中的清单优先，其次是 list_id，都没有时放入收件箱
+	if c.scope != 0 {
+		todo.ListID = c.scope
+	}
+	if todo.ListID == 0 {
+		if todo.ListID, err = inboxID(c.tx, c.userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.editableList(todo.ListID); err != nil {
+		return nil, err
+	}
+
+	if todo.Position, err = topPositionTx(c.tx, todo.ListID); err != nil {
+		return nil, err
+	}
+	if err := insertTodo(c.tx, &todo, priority, c.userID); err != nil {
+		return nil, err
+	}
+	c.events = append(c.events, newTodoEvent("created", todo.ID))
+	return &todo, nil
+}
+
+func (c *batchContext) update(op batchOperation) (*Todo, error) {
+	listID, err := c.editableTodo(op.ID)
+	if err != nil {
+		return nil, err
+	}
+	todo, err := loadTodo(c.tx, op.ID, c.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 与 PATCH 相同，todo 按 JSON Merge Patch 合并
+	if todo, err = mergeTodo(todo, op.Todo); err != nil {
+		return nil, err
+	}
+	var position interface{}
+	if todo.ListID != listID {
+		if err := c.editableList(todo.ListID); err != nil {
+			return nil, err
+		}
+		if position, err = topPositionTx(c.tx, todo.ListID); err != nil {
+			return nil, err
+		}
+	}
+
+	priority, err := validateTodo(&todo)
+	if err != nil {
+		return nil, &apiError{400, err.Error()}
+	}
+	if _, err := execTodoUpdate(c.tx, op.ID, todo, priority, position); err != nil {
+		return nil, err
+	}
+	event := newTodoEvent("updated", op.ID)
+	if todo.ListID != listID {
+		event.FromListID = listID
+	}
+	c.events = append(c.events, event)
+	return c.reload(op.ID)
+}
+
+func (c *batchContext) delete(op batchOperation) error {
+	if _, err := c.editableTodo(op.ID); err != nil {
+		return err
+	}
+	deleted, err := deleteTodosTx(c.tx, "id = ?", op.ID)
+	c.events = append(c.events, deleted...)
+	return err
+}
+
+func (c *batchContext) toggle(op batchOperation) (*Todo, error) {
+	if _, err := c.editableTodo(op.ID); err != nil {
+		return nil, err
+	}
+	if _, _, _, err := toggleTodoDone(c.tx, op.ID, 0); err != nil {
+		return nil, err
+	}
+	nextID, err := spawnNextOccurrence(c.tx, op.ID)
+	if err != nil {
+		return nil, err
+	}
+	c.events = append(c.events, newTodoEvent("toggled", op.ID))
+	if nextID != 0 {
+		c.events = append(c.events, newTodoEvent("created", nextID))
+	}
+	return c.reload(op.ID)
+}
+
+func (c *batchContext) reload(id int) (*Todo, error) {
+	todo, err := loadTodo(c.tx, id, c.userID)
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// run 执行一个操作，把错误转换为结果中的状态码和消息
+func (c *batchContext) run(index int, op batchOperation) batchResult {
+	result := batchResult{Index: index, Op: op.Op, ID: op.ID}
+
+	var todo *Todo
+	var err error
+	switch op.Op {
+	case "create":
+		todo, err = c.create(op)
+	case "update":
+		todo, err = c.update(op)
+	case "delete":
+		err = c.delete(op)
+	case "toggle":
+		todo, err = c.toggle(op)
+	default:
+		err = &apiError{400, "op must be one of create, update, delete, toggle"}
+	}
+
+	if apiErr, ok := err.(*apiError); ok {
+		result.Code, result.Message = apiErr.Code, apiErr.Message
+		return result
+	}
+	if err != nil {
+		log.Printf("Error in batch operation %d (%s): %v", index, op.Op, err)
+		result.Code, result.Message = 500, "Failed to "+op.Op+" todo"
+		return result
+	}
+
+	result.Message = "OK"
+	result.Todo = todo
+	if todo != nil {
+		result.ID = todo.ID
+	}
+	return result
+}
+
+// runSavepoint 在 SAVEPOINT 中执行一个操作，失败时只回滚这个操作
+func (c *batchContext) runSavepoint(index int, op batchOperation) batchResult {
+	if _, err := c.tx.Exec("SAVEPOINT batch_op"); err != nil {
+		log.Println("Error creating savepoint:", err)
+		return batchResult{Index: index, Op: op.Op, ID: op.ID, Code: 500, Message: "Failed to " + op.Op + " todo"}
+	}
+
+	events := len(c.events)
+	result := c.run(index, op)
+	if result.Code != 0 {
+		if _, err := c.tx.Exec("ROLLBACK TO batch_op"); err != nil {
+			log.Println("Error rolling back savepoint:", err)
+		}
+		c.events = c.events[:events]
+	}
+	if _, err := c.tx.Exec("RELEASE batch_op"); err != nil {
+		log.Println("Error releasing savepoint:", err)
+	}
+	return result
+}
+
+// ===== 批量操作 API =====
+
+// POST /api/todos/batch - 在一个事务中执行多个创建 / 修改 / 删除 / 切换操作
+// POST /api/lists/{listID}/todos/batch - 所有操作限定在指定清单内
+func batchTodos(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if len(req.Operations) == 0 {
+		sendError(w, 400, "operations is required")
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		sendError(w, 400, fmt.Sprintf("At most %d operations are allowed per batch", maxBatchOperations))
+		return
+	}
+
+	scope, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	if scope != 0 && !authorizeListTodos(w, r, scope) {
+		return
+	}
+
+	// 开始事务
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	c := &batchContext{tx: tx, userID: currentUserID(r), scope: scope}
+	results := make([]batchResult, 0, len(req.Operations))
+	failed := -1
+	for i, op := range req.Operations {
+		var result batchResult
+		if req.Atomic {
+			result = c.run(i, op)
+		} else {
+			result = c.runSavepoint(i, op)
+		}
+		results = append(results, result)
+
+		if result.Code != 0 && failed < 0 {
+			failed = i
+			if req.Atomic {
+				break
+			}
+		}
+	}
+
+	// atomic 模式下有操作失败：回滚事务，其余操作标记为未生效
+	if req.Atomic && failed >= 0 {
+		reason := results[failed]
+		for i := range req.Operations {
+			if i == failed {
+				continue
+			}
+			if i >= len(results) {
+				results = append(results, batchResult{Index: i, Op: req.Operations[i].Op, ID: req.Operations[i].ID})
+			}
+			results[i].ID = req.Operations[i].ID
+			results[i].Code = 424
+			results[i].Message = fmt.Sprintf("Rolled back because operation %d failed", failed)
+			results[i].Todo = nil
+		}
+		tx.Rollback()
+
+		sendJSON(w, reason.Code, fmt.Sprintf("Batch rolled back: operation %d failed: %s", failed, reason.Message),
+			batchSummary(req.Atomic, false, results))
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing batch:", err)
+		sendError(w, 500, "Failed to commit batch")
+		return
+	}
+	publishTodoEvents(c.events...)
+
+	sendJSON(w, 0, "Batch completed", batchSummary(req.Atomic, true, results))
+}
+
+func batchSummary(atomic, committed bool, results []batchResult) map[string]interface{} {
+	succeeded := 0
+	for _, result := range results {
+		if result.Code == 0 {
+			succeeded++
+		}
+	}
+	return map[string]interface{}{
+		"atomic":    atomic,
+		"committed": committed,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	}
+}
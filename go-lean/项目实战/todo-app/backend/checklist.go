@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== 检查项（子任务）模型 =====
+
+type ChecklistItem struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todo_id"`
+	Title     string    `json:"title"`
+	Done      bool      `json:"done"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChecklistProgress 待办项下检查项的完成进度，没有检查项时 ratio 为 0
+type ChecklistProgress struct {
+	Total int     `json:"total"`
+	Done  int     `json:"done"`
+	Ratio float64 `json:"ratio"`
+}
+
+func newChecklistProgress(total, done int) ChecklistProgress {
+	progress := ChecklistProgress{Total: total, Done: done}
+	if total > 0 {
+		progress.Ratio = float64(done) / float64(total)
+	}
+	return progress
+}
+
+// 统计检查项进度的子查询，拼接在 todoColumns 中
+const checklistProgressColumns = "" +
+	"(SELECT COUNT(*) FROM checklist_items WHERE checklist_items.todo_id = todos.id), " +
+	"(SELECT COUNT(*) FROM checklist_items WHERE checklist_items.todo_id = todos.id AND checklist_items.done = 1)"
+
+const checklistItemColumns = "id, todo_id, title, done, position, created_at"
+
+type checklistItemInput struct {
+	Title *string `json:"title"`
+	Done  *bool   `json:"done"`
+}
+
+type checklistOrder struct {
+	IDs []int `json:"ids"`
+}
+
+// dbtx sql.DB 和 sql.Tx 共有的方法
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ===== 工具函数 =====
+
+func scanChecklistItem(row rowScanner) (ChecklistItem, error) {
+	var item ChecklistItem
+	err := row.Scan(&item.ID, &item.TodoID, &item.Title, &item.Done, &item.Position, &item.CreatedAt)
+	return item, err
+}
+
+func listChecklistItems(q dbtx, todoID int) ([]ChecklistItem, error) {
+	rows, err := q.Query("SELECT "+checklistItemColumns+" FROM checklist_items WHERE todo_id = ? ORDER BY position, id", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ChecklistItem{}
+	for rows.Next() {
+		item, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// autoCompleteTodo 开启了 auto_complete 的待办项在检查项全部完成时自动标记为完成
+// 与 toggleTodo 一样在同一条语句中设置 done 和 completed_at，返回是否自动完成
+func autoCompleteTodo(q dbtx, todoID int, now time.Time) (bool, error) {
+	result, err := q.Exec(`
+		UPDATE todos SET done = 1, completed_at = ?, version = version + 1
+		WHERE id = ? AND auto_complete = 1 AND done = 0
+		AND EXISTS (SELECT 1 FROM checklist_items WHERE todo_id = todos.id)
+		AND NOT EXISTS (SELECT 1 FROM checklist_items WHERE todo_id = todos.id AND done = 0)`,
+		formatTime(now), todoID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// deleteTodosWhere 在事务中删除符合条件的待办项及其检查项，返回每个被删除待办项的 deleted 事件
+func deleteTodosWhere(where string, args ...interface{}) ([]todoEvent, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted, err := deleteTodosTx(tx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	return deleted, tx.Commit()
+}
+
+// 先删除待办项再删除检查项：删除检查项会递增待办项的版本号，不能影响 where 中的 version 条件
+func deleteTodosTx(tx *sql.Tx, where string, args ...interface{}) ([]todoEvent, error) {
+	rows, err := tx.Query("DELETE FROM todos WHERE "+where+" RETURNING id, list_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []todoEvent
+	for rows.Next() {
+		event := newTodoEvent("deleted", 0)
+		if err := rows.Scan(&event.TodoID, &event.ListID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deleted = append(deleted, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, event := range deleted {
+		if _, err := tx.Exec("DELETE FROM checklist_items WHERE todo_id = ?", event.TodoID); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
+}
+
+// pathIDs 解析路径中的待办项 ID 和检查项 ID
+func pathIDs(w http.ResponseWriter, r *http.Request) (todoID, itemID int, ok bool) {
+	todoID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		sendError(w, 400, "Invalid ID format")
+		return 0, 0, false
+	}
+	if r.PathValue("itemID") == "" {
+		return todoID, 0, true
+	}
+	itemID, err = strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		sendError(w, 400, "Invalid item ID format")
+		return 0, 0, false
+	}
+	return todoID, itemID, true
+}
+
+// sendItemWithTodo 返回修改后的检查项，以及重新读取的待办项（含最新进度和完成状态）
+func sendItemWithTodo(w http.ResponseWriter, r *http.Request, message string, item ChecklistItem, autoCompleted bool) {
+	todo, err := findTodo(item.TodoID, currentUserID(r))
+	if err != nil {
+		log.Println("Error reloading todo:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return
+	}
+	if autoCompleted {
+		message += ", todo auto-completed"
+	}
+	sendJSON(w, 0, message, map[string]interface{}{"item": item, "todo": todo})
+}
+
+// ===== 检查项 API =====
+
+// GET /api/todos/{id}/items - 获取待办项下的检查项
+func getChecklistItems(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeTodo(w, r, todoID, RoleViewer); !ok {
+		return
+	}
+
+	items, err := listChecklistItems(db, todoID)
+	if err != nil {
+		log.Println("Error querying checklist items:", err)
+		sendError(w, 500, "Failed to retrieve checklist")
+		return
+	}
+
+	sendJSON(w, 0, "Success", items)
+}
+
+// POST /api/todos/{id}/items - 在末尾添加检查项
+func createChecklistItem(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var input checklistItemInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if input.Title == nil || strings.TrimSpace(*input.Title) == "" {
+		sendError(w, 400, "Title is required")
+		return
+	}
+	done := input.Done != nil && *input.Done
+
+	if _, ok := authorizeTodo(w, r, todoID, RoleEditor); !ok {
+		return
+	}
+
+	item, err := scanChecklistItem(db.QueryRow(`
+		INSERT INTO checklist_items (todo_id, title, done, position, created_at)
+		SELECT ?, ?, ?, COALESCE(MAX(position), -1) + 1, ? FROM checklist_items WHERE todo_id = ?
+		RETURNING `+checklistItemColumns,
+		todoID, strings.TrimSpace(*input.Title), done, formatTime(time.Now()), todoID,
+	))
+	if err != nil {
+		log.Println("Error inserting checklist item:", err)
+		sendError(w, 500, "Failed to create checklist item")
+		return
+	}
+
+	publishTodoEvents(newTodoEvent("updated", todoID))
+
+	w.Header().Set("Location", "/api/todos/"+strconv.Itoa(todoID)+"/items/"+strconv.Itoa(item.ID))
+	sendJSONStatus(w, http.StatusCreated, 0, "Checklist item created successfully", item)
+}
+
+// PATCH /api/todos/{id}/items/{itemID} - 修改检查项标题或完成状态
+func patchChecklistItem(w http.ResponseWriter, r *http.Request) {
+	todoID, itemID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var input checklistItemInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if input.Title != nil {
+		title := strings.TrimSpace(*input.Title)
+		if title == "" {
+			sendError(w, 400, "Title is required")
+			return
+		}
+		input.Title = &title
+	}
+
+	updateChecklistItem(w, r, "title = COALESCE(?, title), done = COALESCE(?, done)",
+		[]interface{}{input.Title, input.Done}, todoID, itemID, "Checklist item updated successfully")
+}
+
+// POST /api/todos/{id}/items/{itemID}/toggle - 切换检查项完成状态
+func toggleChecklistItem(w http.ResponseWriter, r *http.Request) {
+	todoID, itemID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	updateChecklistItem(w, r, "done = NOT done", nil, todoID, itemID, "Checklist item toggled")
+}
+
+// updateChecklistItem 在事务中修改检查项，并检查是否需要自动完成待办项
+func updateChecklistItem(w http.ResponseWriter, r *http.Request, set string, setArgs []interface{}, todoID, itemID int, message string) {
+	if _, ok := authorizeTodo(w, r, todoID, RoleEditor); !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to update checklist item")
+		return
+	}
+	defer tx.Rollback()
+
+	args := append(setArgs, itemID, todoID)
+	item, err := scanChecklistItem(tx.QueryRow(
+		"UPDATE checklist_items SET "+set+" WHERE id = ? AND todo_id = ? RETURNING "+checklistItemColumns,
+		args...,
+	))
+	if err == sql.ErrNoRows {
+		sendError(w, 404, "Checklist item not found")
+		return
+	} else if err != nil {
+		log.Println("Error updating checklist item:", err)
+		sendError(w, 500, "Failed to update checklist item")
+		return
+	}
+
+	// 自动完成时与切换待办项一样发布 toggled 事件
+	autoCompleted := false
+	events := []todoEvent{newTodoEvent("updated", todoID)}
+	if item.Done {
+		autoCompleted, err = autoCompleteTodo(tx, todoID, time.Now())
+		var nextID int
+		if err == nil && autoCompleted {
+			events[0].Type = "toggled"
+			nextID, err = spawnNextOccurrence(tx, todoID)
+		}
+		if err == nil && nextID != 0 {
+			events = append(events, newTodoEvent("created", nextID))
+		}
+		if err != nil {
+			log.Println("Error auto-completing todo:", err)
+			sendError(w, 500, "Failed to update checklist item")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to update checklist item")
+		return
+	}
+	publishTodoEvents(events...)
+
+	sendItemWithTodo(w, r, message, item, autoCompleted)
+}
+
+// PUT /api/todos/{id}/items/order - 按给出的 ID 顺序重排检查项
+// 请求体必须包含该待办项下的全部检查项 ID，每个恰好一次
+func reorderChecklistItems(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var order checklistOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+
+	if _, ok := authorizeTodo(w, r, todoID, RoleEditor); !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to reorder checklist")
+		return
+	}
+	defer tx.Rollback()
+
+	items, err := listChecklistItems(tx, todoID)
+	if err != nil {
+		log.Println("Error querying checklist items:", err)
+		sendError(w, 500, "Failed to reorder checklist")
+		return
+	}
+
+	remaining := map[int]bool{}
+	for _, item := range items {
+		remaining[item.ID] = true
+	}
+	for _, id := range order.IDs {
+		if !remaining[id] {
+			sendError(w, 400, "ids must list every checklist item of this todo exactly once")
+			return
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		sendError(w, 400, "ids must list every checklist item of this todo exactly once")
+		return
+	}
+
+	for position, id := range order.IDs {
+		if _, err := tx.Exec("UPDATE checklist_items SET position = ? WHERE id = ?", position, id); err != nil {
+			log.Println("Error reordering checklist items:", err)
+			sendError(w, 500, "Failed to reorder checklist")
+			return
+		}
+	}
+
+	items, err = listChecklistItems(tx, todoID)
+	if err != nil {
+		log.Println("Error querying checklist items:", err)
+		sendError(w, 500, "Failed to reorder checklist")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to reorder checklist")
+		return
+	}
+	publishTodoEvents(newTodoEvent("updated", todoID))
+
+	sendJSON(w, 0, "Checklist reordered", items)
+}
+
+// DELETE /api/todos/{id}/items/{itemID} - 删除检查项
+func deleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	todoID, itemID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeTodo(w, r, todoID, RoleEditor); !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM checklist_items WHERE id = ? AND todo_id = ?", itemID, todoID)
+	if err != nil {
+		log.Println("Error deleting checklist item:", err)
+		sendError(w, 500, "Failed to delete checklist item")
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		sendError(w, 500, "Failed to get rows affected")
+		return
+	}
+
+	if rowsAffected == 0 {
+		sendError(w, 404, "Checklist item not found")
+		return
+	}
+	publishTodoEvents(newTodoEvent("updated", todoID))
+
+	sendJSON(w, 0, "Checklist item deleted successfully", map[string]interface{}{"id": itemID})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ===== 优先级 =====
+
+// 优先级在数据库中按等级存成整数，便于排序
+var priorityNames = []string{"low", "normal", "high", "urgent"}
+
+const defaultPriority = "normal"
+
+// priorityLevel 把优先级名称转换成数据库中的等级，空字符串视为 normal
+func priorityLevel(name string) (int, error) {
+	if name == "" {
+		name = defaultPriority
+	}
+	for level, n := range priorityNames {
+		if n == name {
+			return level, nil
+		}
+	}
+	return 0, errors.New("priority must be one of low, normal, high, urgent")
+}
+
+func priorityName(level int) string {
+	if level < 0 || level >= len(priorityNames) {
+		return defaultPriority
+	}
+	return priorityNames[level]
+}
+
+// ===== 可为空的时间 =====
+
+// nullableTime 把 *time.Time 写成 SQLite 时间字符串，nil 写成 NULL
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTime(*t)
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time.UTC()
+	return &v
+}
+
+// ===== 截止时间过滤 =====
+
+// dueRange 根据 due=overdue|today 计算截止时间过滤条件
+// today 按 tz 参数（IANA 时区名，默认 UTC）中的自然日计算
+func dueRange(r *http.Request, due string, now time.Time) (string, []interface{}, error) {
+	switch due {
+	case "overdue":
+		return "done = 0 AND due_at < ?", []interface{}{formatTime(now)}, nil
+	case "today":
+		loc := time.UTC
+		if tz := r.URL.Query().Get("tz"); tz != "" {
+			var err error
+			loc, err = time.LoadLocation(tz)
+			if err != nil {
+				return "", nil, errors.New("invalid tz")
+			}
+		}
+		local := now.In(loc)
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		end := start.AddDate(0, 0, 1)
+		return "due_at >= ? AND due_at < ?", []interface{}{formatTime(start), formatTime(end)}, nil
+	default:
+		return "", nil, errors.New("due must be overdue or today")
+	}
+}
+
+// withDue 固定 due 过滤条件的列表路由：/api/todos/overdue、/api/todos/due-today
+func withDue(due string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		q.Set("due", due)
+		r.URL.RawQuery = q.Encode()
+		handler(w, r)
+	}
+}
+
+// ===== 提醒 =====
+
+const (
+	// 截止时间前多久记录提醒
+	reminderLead = 30 * time.Minute
+	// 调度器检查间隔
+	reminderInterval = time.Minute
+)
+
+type Reminder struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todo_id"`
+	Title     string    `json:"title"`
+	DueAt     time.Time `json:"due_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// recordReminders 为即将到期（或已经过期）且未完成的待办项记录提醒
+// 同一个截止时间只记录一次，修改截止时间后会重新提醒
+func recordReminders(now time.Time) (int64, error) {
+	result, err := db.Exec(`
+		INSERT OR IGNORE INTO reminders (todo_id, user_id, due_at, created_at)
+		SELECT id, user_id, due_at, ? FROM todos
+		WHERE done = 0 AND user_id IS NOT NULL AND due_at IS NOT NULL AND due_at <= ?`,
+		formatTime(now),
+		formatTime(now.Add(reminderLead)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// startReminderScheduler 在后台定期记录提醒，ctx 取消时退出
+func startReminderScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reminderInterval)
+		defer ticker.Stop()
+
+		for {
+			n, err := recordReminders(time.Now())
+			if err != nil {
+				log.Println("Error recording reminders:", err)
+			} else if n > 0 {
+				log.Printf("Recorded %d reminder(s)", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GET /api/reminders - 获取当前用户的提醒（最新的在前）
+// since=RFC3339 只返回之后记录的提醒，limit 默认 50
+func getReminders(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	limit := defaultPageSize
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			sendError(w, 400, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	since := time.Time{}
+	if v := params.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendError(w, 400, "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = t
+	}
+
+	rows, err := db.Query(`
+		SELECT reminders.id, reminders.todo_id, todos.title, reminders.due_at, reminders.created_at
+		FROM reminders
+		JOIN todos ON todos.id = reminders.todo_id
+		WHERE reminders.user_id = ? AND reminders.created_at > ?
+		ORDER BY reminders.created_at DESC, reminders.id DESC
+		LIMIT ?`,
+		currentUserID(r), formatTime(since), limit,
+	)
+	if err != nil {
+		log.Println("Error querying reminders:", err)
+		sendError(w, 500, "Failed to retrieve reminders")
+		return
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		var reminder Reminder
+		if err := rows.Scan(&reminder.ID, &reminder.TodoID, &reminder.Title, &reminder.DueAt, &reminder.CreatedAt); err != nil {
+			log.Println("Error scanning reminder:", err)
+			continue
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Println("Error iterating reminders:", err)
+		sendError(w, 500, "Error reading reminders")
+		return
+	}
+
+	sendJSON(w, 0, "Success", reminders)
+}
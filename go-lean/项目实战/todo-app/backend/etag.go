@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ===== 乐观并发控制 =====
+//
+// 待办项的 ETag 由 version 列生成，每次修改（包括检查项变化）版本号都会加 1。
+// 修改前先读出当前版本号与 If-Match 比较，UPDATE / DELETE 再带上 version = ? 条件，
+// 读出之后被其他请求修改时影响行数为 0，同样返回 412。
+
+// todoETag 返回版本号对应的 ETag（强验证器）
+func todoETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches 判断 If-Match / If-None-Match 中的 ETag 列表是否包含 etag，* 匹配任意值
+// weak 为 true 时使用弱比较（忽略 W/ 前缀），用于 If-None-Match；If-Match 使用强比较
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch 请求带 If-Match 且与当前版本不匹配时返回 412，并在响应中带上当前的 ETag
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, todoETag(version), false) {
+		return true
+	}
+	sendPreconditionFailed(w, version)
+	return false
+}
+
+// sendPreconditionFailed 待办项已被修改，客户端需要重新获取后再提交
+func sendPreconditionFailed(w http.ResponseWriter, version int) {
+	if version > 0 {
+		w.Header().Set("ETag", todoETag(version))
+	}
+	sendError(w, 412, "Todo has been modified, reload and retry")
+}
+
+// todoVersion 查询待办项当前的版本号
+func todoVersion(id int) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT version FROM todos WHERE id = ?", id).Scan(&version)
+	return version, err
+}
+
+// ifMatchVersion 请求带 If-Match 时检查并返回当前版本号，作为后续修改的条件；不带时返回 0
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, id int) (int, bool) {
+	if r.Header.Get("If-Match") == "" {
+		return 0, true
+	}
+	version, err := todoVersion(id)
+	if err != nil {
+		log.Println("Error querying todo version:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return 0, false
+	}
+	if !checkIfMatch(w, r, version) {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== 实时事件（Server-Sent Events） =====
+//
+// 修改待办项的处理器在事务提交后调用 publishTodoEvents，由进程内的 todoEvents 分发给订阅者。
+// 每个事件有递增的 ID（"启动标识-序号"），最近的事件保存在回放缓冲区中：
+// 断线重连时浏览器带上 Last-Event-ID，从缓冲区补发错过的事件；
+// 缓冲区中已经没有（或服务重启过）时发送 reset 事件，客户端应重新获取全部待办项。
+
+const (
+	eventReplaySize        = 1000             // 回放缓冲区保存的事件数
+	eventSubscriberBuffer  = 64               // 每个订阅者未发送的事件数上限，超过时断开让客户端重连补发
+	eventHeartbeatInterval = 15 * time.Second // 心跳注释的间隔，防止代理因连接空闲而断开
+	eventRetry             = 3000             // 建议客户端断线后的重连间隔（毫秒）
+)
+
+// todoEvent 一个待办项变更事件，type 为 created / updated / deleted / toggled
+type todoEvent struct {
+	ID         uint64 `json:"-"`
+	Type       string `json:"type"`
+	TodoID     int    `json:"todo_id"`
+	ListID     int    `json:"list_id"`
+	FromListID int    `json:"from_list_id,omitempty"` // 待办项移到其他清单时为原来的清单
+	Todo       *Todo  `json:"todo,omitempty"`         // deleted 事件没有
+
+	users []int // 能收到事件的用户（发布时清单的成员）
+}
+
+func newTodoEvent(eventType string, todoID int) todoEvent {
+	return todoEvent{Type: eventType, TodoID: todoID}
+}
+
+// visibleTo 用户能否收到事件，scope 不为 0 时只要该清单的事件
+func (e todoEvent) visibleTo(userID, scope int) bool {
+	if scope != 0 && e.ListID != scope && e.FromListID != scope {
+		return false
+	}
+	for _, id := range e.users {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// eventHub 进程内的发布 / 订阅中心
+type eventHub struct {
+	mu          sync.Mutex
+	epoch       string // 启动标识，服务重启后旧的事件 ID 不再有效
+	lastID      uint64
+	replay      []todoEvent
+	subscribers map[chan todoEvent]struct{}
+}
+
+var todoEvents = newEventHub()
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: map[chan todoEvent]struct{}{},
+	}
+}
+
+// eventID 把序号写成 SSE 的事件 ID
+func (h *eventHub) eventID(seq uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// publish 分配事件 ID、放入回放缓冲区并发送给所有订阅者
+// 订阅者的缓冲已满时关闭它的通道，客户端重连后从回放缓冲区补发
+func (h *eventHub) publish(event todoEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	event.ID = h.lastID
+	if len(h.replay) == eventReplaySize {
+		copy(h.replay, h.replay[1:])
+		h.replay = h.replay[:eventReplaySize-1]
+	}
+	h.replay = append(h.replay, event)
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe 注册订阅者，返回 lastEventID 之后错过的事件
+// lastEventID 无效或对应的事件已不在缓冲区中时 reset 为 true，此时不补发
+func (h *eventHub) subscribe(lastEventID string) (ch chan todoEvent, missed []todoEvent, reset bool, latest string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if lastEventID != "" {
+		seq, ok := h.parseEventID(lastEventID)
+		oldest := h.lastID + 1
+		if len(h.replay) > 0 {
+			oldest = h.replay[0].ID
+		}
+		if !ok || seq > h.lastID || seq+1 < oldest {
+			reset = true
+		} else {
+			missed = append(missed, h.replay[len(h.replay)-int(h.lastID-seq):]...)
+		}
+	}
+
+	ch = make(chan todoEvent, eventSubscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+	return ch, missed, reset, h.eventID(h.lastID)
+}
+
+// unsubscribe 取消订阅（通道可能已经因为缓冲已满被关闭）
+func (h *eventHub) unsubscribe(ch chan todoEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// parseEventID 解析本次启动分配的事件 ID
+func (h *eventHub) parseEventID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// publishTodoEvents 在事务提交后调用：读取待办项的最新内容，发布给所在清单的成员
+// deleted 事件需要带上 ListID；已经设置 users 的事件（例如删除清单时）不再查询成员
+func publishTodoEvents(events ...todoEvent) {
+	for _, event := range events {
+		if event.Type != "deleted" {
+			todo, err := scanTodo(db.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = ?", event.TodoID))
+			if err != nil {
+				// 已经被其他请求删除时会另有 deleted 事件
+				continue
+			}
+			event.ListID, event.Todo = todo.ListID, &todo
+		}
+		if event.users == nil {
+			users, err := eventAudience(event.ListID, event.FromListID)
+			if err != nil {
+				log.Println("Error querying event audience:", err)
+				continue
+			}
+			event.users = users
+		}
+		todoEvents.publish(event)
+	}
+}
+
+// eventAudience 返回清单的成员，fromListID 不为 0 时也包括原来清单的成员
+func eventAudience(listID, fromListID int) ([]int, error) {
+	rows, err := db.Query("SELECT DISTINCT user_id FROM list_members WHERE list_id IN (?, ?)", listID, fromListID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
+
+// writeEvent 按 SSE 格式写出一个事件
+func writeEvent(w http.ResponseWriter, id, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, eventType, payload)
+	return err
+}
+
+// ===== API 处理器 =====
+
+// GET /api/todos/events - 推送用户所在清单中待办项的变更（text/event-stream）
+// GET /api/lists/{listID}/todos/events - 只推送指定清单的变更
+// 重连时通过 Last-Event-ID 头（或 last_event_id 参数）补发错过的事件
+func streamTodoEvents(w http.ResponseWriter, r *http.Request) {
+	scope, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	if scope != 0 {
+		if _, ok := authorizeList(w, r, scope, RoleViewer); !ok {
+			return
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := rc.Flush(); err != nil {
+		sendError(w, 500, "Streaming is not supported")
+		return
+	}
+
+	userID := currentUserID(r)
+	ch, missed, reset, latest := todoEvents.subscribe(lastEventID)
+	defer todoEvents.unsubscribe(ch)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+	if reset {
+		writeEvent(w, latest, "reset", map[string]interface{}{})
+	}
+	for _, event := range missed {
+		if event.visibleTo(userID, scope) {
+			writeEvent(w, todoEvents.eventID(event.ID), event.Type, event)
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !event.visibleTo(userID, scope) {
+				continue
+			}
+			if err := writeEvent(w, todoEvents.eventID(event.ID), event.Type, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
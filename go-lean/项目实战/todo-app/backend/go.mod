@@ -1,5 +1,8 @@
 module todo-app
 
-go 1.21
+go 1.22
 
-require github.com/mattn/go-sqlite3 v1.14.18
+require (
+	github.com/mattn/go-sqlite3 v1.14.18
+	golang.org/x/crypto v0.14.0
+)
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== iCalendar（RFC 5545）导出导入 =====
+//
+// 每个待办项导出为一个 VTODO，用 uid 标识。导出的内容只取决于待办项本身（DTSTAMP 使用创建时间），
+// 同样的数据每次导出完全相同；导入流程见 import.go。
+
+// 导出的日历标识
+const icsProdID = "-//go-lean//todo-app//EN"
+
+// 记录重复规则时区的扩展属性：DUE 统一导出为 UTC，时区单独保存，导入时恢复
+const icsTZProperty = "X-TODO-APP-TZ"
+
+// iCalendar 的 UTC 时间格式
+const icsTimeLayout = "20060102T150405Z"
+
+// ===== 优先级映射 =====
+
+// icsPriority 把优先级转换成 PRIORITY（1 最高，9 最低），normal 不导出
+func icsPriority(priority string) int {
+	switch priority {
+	case "urgent":
+		return 1
+	case "high":
+		return 3
+	case "low":
+		return 9
+	}
+	return 0
+}
+
+// priorityFromICS PRIORITY 1 为 urgent，2-4 为 high，6-9 为 low，0（未定义）和 5 为 normal
+func priorityFromICS(value int) string {
+	switch {
+	case value == 1:
+		return "urgent"
+	case value >= 2 && value <= 4:
+		return "high"
+	case value >= 6:
+		return "low"
+	}
+	return defaultPriority
+}
+
+// ===== 导出 =====
+
+// icsWriter 按 RFC 5545 写内容行：CRLF 换行，超过 75 字节的行折叠（不拆开 UTF-8 字符）
+type icsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *icsWriter) line(name, value string) {
+	line := name + ":" + value
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.buf.WriteString(line[:cut] + "\r\n")
+		// 续行以一个空格开头，空格本身占一个字节
+		line = " " + line[cut:]
+	}
+	w.buf.WriteString(line + "\r\n")
+}
+
+// escapeICSText 转义 TEXT 值中的反斜杠、分号、逗号和换行
+func escapeICSText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format(icsTimeLayout)
+}
+
+// writeICS 把待办项写成一个 VCALENDAR
+func writeICS(todos []Todo) []byte {
+	w := &icsWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", icsProdID)
+	w.line("CALSCALE", "GREGORIAN")
+	for _, todo := range todos {
+		w.line("BEGIN", "VTODO")
+		w.line("UID", escapeICSText(todo.UID))
+		w.line("DTSTAMP", formatICSTime(todo.CreatedAt))
+		w.line("CREATED", formatICSTime(todo.CreatedAt))
+		w.line("SUMMARY", escapeICSText(todo.Title))
+		if todo.Desc != "" {
+			w.line("DESCRIPTION", escapeICSText(todo.Desc))
+		}
+		if todo.Done {
+			w.line("STATUS", "COMPLETED")
+		} else {
+			w.line("STATUS", "NEEDS-ACTION")
+		}
+		if priority := icsPriority(todo.Priority); priority != 0 {
+			w.line("PRIORITY", strconv.Itoa(priority))
+		}
+		if todo.DueAt != nil {
+			w.line("DUE", formatICSTime(*todo.DueAt))
+		}
+		if todo.CompletedAt != nil {
+			w.line("COMPLETED", formatICSTime(*todo.CompletedAt))
+		}
+		if todo.Recurrence != "" {
+			w.line("RRULE", todo.Recurrence)
+			w.line(icsTZProperty, todo.RecurrenceTZ)
+		}
+		w.line("END", "VTODO")
+	}
+	w.line("END", "VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// ===== 解析 =====
+
+// icsProperty 一个内容行：名称和参数名均为大写
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsTodo 从 VTODO 中读取的字段
+type icsTodo struct {
+	UID         string
+	Summary     string
+	Desc        string
+	Status      string
+	Priority    int
+	DueAt       *time.Time
+	DueTZ       string
+	CompletedAt *time.Time
+	Recurrence  string
+	TZ          string
+}
+
+// unfoldICS 统一换行并展开折叠的行
+func unfoldICS(data []byte) []string {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+	text = strings.ReplaceAll(text, "\n\t", "")
+	return strings.Split(text, "\n")
+}
+
+// parseICSLine 解析 NAME;PARAM=VALUE:value，参数值可以加双引号
+func parseICSLine(line string) (icsProperty, error) {
+	prop := icsProperty{Params: map[string]string{}}
+	inQuote := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuote = !inQuote
+		} else if c == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, errors.New("missing ':'")
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	prop.Value = line[colon+1:]
+	return prop, nil
+}
+
+// unescapeICSText 还原 escapeICSText 转义的字符
+func unescapeICSText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseICSTime 解析 DUE / COMPLETED：UTC 时间、带 TZID 的本地时间、不带时区的浮动时间（按 UTC）或日期，
+// 只有日期时视为当天结束（UTC）。返回时间和 TZID
+func parseICSTime(prop icsProperty) (time.Time, string, error) {
+	value := prop.Value
+	if prop.Params["VALUE"] == "DATE" || len(value) == 8 {
+		day, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid %s", prop.Name)
+		}
+		return day.AddDate(0, 0, 1).Add(-time.Second), "", nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsTimeLayout, value)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid %s", prop.Name)
+		}
+		return t, "", nil
+	}
+
+	loc := time.UTC
+	tzid := prop.Params["TZID"]
+	if tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, "", fmt.Errorf("unknown TZID %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid %s", prop.Name)
+	}
+	return t.UTC(), tzid, nil
+}
+
+// parseICS 读取日历中的所有 VTODO，忽略其他组件（VEVENT、VTIMEZONE 以及 VTODO 内的 VALARM 等）
+func parseICS(data []byte) ([]icsTodo, error) {
+	var todos []icsTodo
+	var stack []string
+	var current *icsTodo
+
+	for i, line := range unfoldICS(data) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseICSLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if len(stack) == 0 && (prop.Name != "BEGIN" || strings.ToUpper(prop.Value) != "VCALENDAR") {
+			return nil, errors.New("not an iCalendar file")
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			component := strings.ToUpper(prop.Value)
+			stack = append(stack, component)
+			if component == "VTODO" && len(stack) == 2 {
+				if len(todos) == maxImportTodos {
+					return nil, fmt.Errorf("at most %d todos can be imported at once", maxImportTodos)
+				}
+				todos = append(todos, icsTodo{})
+				current = &todos[len(todos)-1]
+			}
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 1 {
+				current = nil
+			}
+			continue
+		}
+
+		// 只处理 VTODO 自身的属性
+		if current == nil || len(stack) != 2 {
+			continue
+		}
+		if err := current.set(prop); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+
+	if len(stack) != 0 {
+		return nil, errors.New("unterminated " + stack[len(stack)-1])
+	}
+	return todos, nil
+}
+
+// set 把一个属性写入 VTODO，不认识的属性忽略
+func (t *icsTodo) set(prop icsProperty) error {
+	var err error
+	switch prop.Name {
+	case "UID":
+		t.UID = unescapeICSText(prop.Value)
+	case "SUMMARY":
+		t.Summary = unescapeICSText(prop.Value)
+	case "DESCRIPTION":
+		t.Desc = unescapeICSText(prop.Value)
+	case "STATUS":
+		t.Status = strings.ToUpper(prop.Value)
+	case "PRIORITY":
+		t.Priority, err = strconv.Atoi(prop.Value)
+		if err != nil || t.Priority < 0 || t.Priority > 9 {
+			return errors.New("PRIORITY must be between 0 and 9")
+		}
+	case "DUE":
+		due, tzid, err := parseICSTime(prop)
+		if err != nil {
+			return err
+		}
+		t.DueAt, t.DueTZ = &due, tzid
+	case "COMPLETED":
+		completed, _, err := parseICSTime(prop)
+		if err != nil {
+			return err
+		}
+		t.CompletedAt = &completed
+	case "RRULE":
+		t.Recurrence = prop.Value
+	case icsTZProperty:
+		t.TZ = prop.Value
+	}
+	return nil
+}
+
+// entry 转换成待办项并验证，STATUS 为 COMPLETED 或 CANCELLED（或没有 STATUS 但有 COMPLETED）时为已完成
+// 重复规则的时区依次取 X-TODO-APP-TZ、DUE 的 TZID，都没有时为 UTC；iCalendar 中没有的标签和扩展字段更新时保持不变
+func (t icsTodo) entry() (importEntry, error) {
+	todo := Todo{
+		UID:        t.UID,
+		Title:      t.Summary,
+		Desc:       t.Desc,
+		Done:       t.Status == "COMPLETED" || t.Status == "CANCELLED" || (t.Status == "" && t.CompletedAt != nil),
+		Priority:   priorityFromICS(t.Priority),
+		DueAt:      t.DueAt,
+		Recurrence: t.Recurrence,
+	}
+	if todo.Recurrence != "" {
+		todo.RecurrenceTZ = t.TZ
+		if todo.RecurrenceTZ == "" {
+			todo.RecurrenceTZ = t.DueTZ
+		}
+	}
+	if todo.Done {
+		todo.CompletedAt = t.CompletedAt
+	}
+
+	entry := importEntry{keep: func(current Todo, todo *Todo) {
+		todo.Tags, todo.Extensions = current.Tags, current.Extensions
+	}}
+	if strings.TrimSpace(todo.Title) == "" {
+		return entry, errors.New("SUMMARY is required")
+	}
+	priority, err := validateTodo(&todo)
+	entry.Todo, entry.Priority = todo, priority
+	return entry, err
+}
+
+// parseICSEntries 解析导入的 .ics 文件
+func parseICSEntries(data []byte) ([]importEntry, error) {
+	todos, err := parseICS(data)
+	if err != nil {
+		return nil, errors.New("Invalid calendar: " + err.Error())
+	}
+	entries := make([]importEntry, 0, len(todos))
+	for i, t := range todos {
+		entry, err := t.entry()
+		if err != nil {
+			return nil, fmt.Errorf("VTODO %d: %s", i+1, err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ===== API 处理器 =====
+
+// GET /api/todos.ics - 导出用户所在清单中的全部待办项
+// GET /api/lists/{listID}/todos.ics - 只导出指定清单
+func exportTodosICS(w http.ResponseWriter, r *http.Request) {
+	todos, ok := exportableTodos(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="todos.ics"`)
+	w.Write(writeICS(todos))
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// ===== 导出与导入 =====
+//
+// iCalendar（ics.go）和 todo.txt（todotxt.go）共用同一套导入流程：
+// 文件解析成 importEntry 后在一个事务中按 uid 逐个新建或更新，内容没有变化的待办项不会修改，
+// 所以把导出的文件再导入一次不会产生任何变化。
+
+// 导入文件的大小和待办项数量上限
+const (
+	maxImportSize  = 5 << 20
+	maxImportTodos = 1000
+)
+
+// newTodoUID 生成待办项的全局唯一标识
+func newTodoUID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf) + "@todo-app", nil
+}
+
+// importEntry 从文件中读出的一个待办项（已验证）
+type importEntry struct {
+	Todo      Todo
+	Priority  int
+	CreatedAt *time.Time // 文件中的创建时间，只用于新建的待办项
+
+	// keep 更新已有的待办项时，把文件格式表示不了的字段设为原来的值
+	keep func(current Todo, todo *Todo)
+}
+
+// importResult 一个待办项的导入结果，action 为 created / updated / unchanged
+type importResult struct {
+	UID    string `json:"uid"`
+	ID     int    `json:"id"`
+	Action string `json:"action"`
+}
+
+// exportableTodos 查询要导出的待办项：用户所在清单中的全部待办项，在 /api/lists/{listID}/todos 下只取该清单
+func exportableTodos(w http.ResponseWriter, r *http.Request) ([]Todo, bool) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return nil, false
+	}
+	if listID != 0 {
+		if _, ok := authorizeList(w, r, listID, RoleViewer); !ok {
+			return nil, false
+		}
+	}
+
+	rows, err := db.Query(
+		"SELECT "+todoColumns+" FROM todos WHERE list_id IN (SELECT list_id FROM list_members WHERE user_id = ?) AND (? = 0 OR list_id = ?) ORDER BY id",
+		currentUserID(r), listID, listID,
+	)
+	if err != nil {
+		log.Println("Error querying todos:", err)
+		sendError(w, 500, "Failed to export todos")
+		return nil, false
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			log.Println("Error scanning todo:", err)
+			sendError(w, 500, "Failed to export todos")
+			return nil, false
+		}
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating todos:", err)
+		sendError(w, 500, "Failed to export todos")
+		return nil, false
+	}
+	return todos, true
+}
+
+// findTodoByUID 在用户可见的清单中按 UID 查找待办项，scope 不为 0 时只在该清单中查找，找不到时返回 0
+func findTodoByUID(c *batchContext, uid string) (int, error) {
+	if uid == "" {
+		return 0, nil
+	}
+	var id int
+	err := c.tx.QueryRow(`
+		SELECT id FROM todos
+		WHERE uid = ? AND list_id IN (SELECT list_id FROM list_members WHERE user_id = ?) AND (? = 0 OR list_id = ?)
+		ORDER BY id LIMIT 1`,
+		uid, c.userID, c.scope, c.scope,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// upsertImported 按 UID 更新已有的待办项，没有时新建（放入路由中的清单或收件箱）
+func upsertImported(c *batchContext, entry importEntry) (importResult, error) {
+	todo := entry.Todo
+	result := importResult{UID: todo.UID}
+	id, err := findTodoByUID(c, todo.UID)
+	if err != nil {
+		return result, err
+	}
+
+	if id == 0 {
+		listID := c.scope
+		if listID == 0 {
+			if listID, err = inboxID(c.tx, c.userID); err != nil {
+				return result, err
+			}
+		}
+		if err := c.editableList(listID); err != nil {
+			return result, err
+		}
+
+		completedAt := todo.CompletedAt
+		todo.ListID = listID
+		if todo.Position, err = topPositionTx(c.tx, listID); err != nil {
+			return result, err
+		}
+		if err := insertTodo(c.tx, &todo, entry.Priority, c.userID); err != nil {
+			return result, err
+		}
+		// 保留文件中的创建时间和完成时间（insertTodo 使用当前时间）
+		if !todo.Done {
+			completedAt = nil
+		}
+		if entry.CreatedAt != nil || completedAt != nil {
+			_, err := c.tx.Exec(
+				"UPDATE todos SET created_at = COALESCE(?, created_at), completed_at = COALESCE(?, completed_at) WHERE id = ?",
+				nullableTime(entry.CreatedAt), nullableTime(completedAt), todo.ID,
+			)
+			if err != nil {
+				return result, err
+			}
+		}
+		result.UID, result.ID, result.Action = todo.UID, todo.ID, "created"
+		c.events = append(c.events, newTodoEvent("created", todo.ID))
+		return result, nil
+	}
+
+	if _, err := c.editableTodo(id); err != nil {
+		return result, err
+	}
+	current, err := loadTodo(c.tx, id, c.userID)
+	if err != nil {
+		return result, err
+	}
+	result.ID = id
+	if entry.keep != nil {
+		entry.keep(current, &todo)
+	}
+
+	// 已完成的待办项：文件中没有完成时间时保留原来的，原来未完成时为现在
+	if !todo.Done {
+		todo.CompletedAt = nil
+	} else if todo.CompletedAt == nil {
+		todo.CompletedAt = current.CompletedAt
+		if todo.CompletedAt == nil {
+			now := time.Now().UTC().Truncate(time.Second)
+			todo.CompletedAt = &now
+		}
+	}
+
+	if current.Title == todo.Title && current.Desc == todo.Desc && current.Done == todo.Done &&
+		current.Priority == todo.Priority && sameTime(current.DueAt, todo.DueAt) && sameTime(current.CompletedAt, todo.CompletedAt) &&
+		current.Recurrence == todo.Recurrence && current.RecurrenceTZ == todo.RecurrenceTZ &&
+		reflect.DeepEqual(current.Tags, todo.Tags) && reflect.DeepEqual(current.Extensions, todo.Extensions) {
+		result.Action = "unchanged"
+		return result, nil
+	}
+
+	_, err = c.tx.Exec(`
+		UPDATE todos SET title = ?, desc = ?, done = ?, priority = ?, due_at = ?, completed_at = ?, recurrence = ?, recurrence_tz = ?,
+		tags = ?, extensions = ?, version = version + 1
+		WHERE id = ?`,
+		todo.Title, todo.Desc, todo.Done, entry.Priority, nullableTime(todo.DueAt), nullableTime(todo.CompletedAt),
+		todo.Recurrence, todo.RecurrenceTZ, tagsJSON(todo.Tags), extensionsJSON(todo.Extensions), id,
+	)
+	result.Action = "updated"
+	c.events = append(c.events, newTodoEvent("updated", id))
+	return result, err
+}
+
+// sameTime 比较两个可为空的时间（精确到秒）
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Unix() == b.Unix()
+}
+
+// readImportFile 读取上传的文件：multipart/form-data 中的 file 字段，或者直接作为请求体
+func readImportFile(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			sendError(w, 400, "Upload the file in the file field")
+			return nil, false
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, 413, fmt.Sprintf("File must be at most %d bytes", maxImportSize))
+		} else {
+			sendError(w, 400, "Failed to read file")
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// ===== API 处理器 =====
+
+// POST /api/todos/import?format=ics|todotxt - 导入文件，按 UID 新建或更新待办项，format 默认为 ics
+// POST /api/lists/{listID}/todos/import - 新建的待办项放入指定清单，只更新该清单中的待办项
+// 所有待办项在同一个事务中导入，任意一个无效时整体不生效
+func importTodos(w http.ResponseWriter, r *http.Request) {
+	var parse func([]byte) ([]importEntry, error)
+	switch r.URL.Query().Get("format") {
+	case "", "ics":
+		parse = parseICSEntries
+	case "todotxt":
+		parse = parseTodoTxt
+	default:
+		sendError(w, 400, "format must be one of ics, todotxt")
+		return
+	}
+
+	scope, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	if scope != 0 && !authorizeListTodos(w, r, scope) {
+		return
+	}
+
+	data, ok := readImportFile(w, r)
+	if !ok {
+		return
+	}
+	entries, err := parse(data)
+	if err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	c := &batchContext{tx: tx, userID: currentUserID(r), scope: scope}
+	results := make([]importResult, 0, len(entries))
+	counts := map[string]int{"created": 0, "updated": 0, "unchanged": 0}
+	for i, entry := range entries {
+		result, err := upsertImported(c, entry)
+		if apiErr, ok := err.(*apiError); ok {
+			sendError(w, apiErr.Code, fmt.Sprintf("Todo %d: %s", i+1, apiErr.Message))
+			return
+		} else if err != nil {
+			log.Printf("Error importing todo %d: %v", i+1, err)
+			sendError(w, 500, "Failed to import todos")
+			return
+		}
+		results = append(results, result)
+		counts[result.Action]++
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing import:", err)
+		sendError(w, 500, "Failed to import todos")
+		return
+	}
+	publishTodoEvents(c.events...)
+
+	sendJSON(w, 0, "Import completed", map[string]interface{}{
+		"created":   counts["created"],
+		"updated":   counts["updated"],
+		"unchanged": counts["unchanged"],
+		"results":   results,
+	})
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== 清单模型 =====
+
+// 清单成员角色：owner 管理清单和成员，editor 修改待办项，viewer 只读
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+type List struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   int       `json:"owner_id"`
+	Inbox     bool      `json:"inbox"`
+	Archived  bool      `json:"archived"`
+	Role      string    `json:"role"` // 当前用户在清单中的角色
+	TodoCount int       `json:"todo_count"`
+	DoneCount int       `json:"done_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListMember struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type listInput struct {
+	Name     *string `json:"name"`
+	Archived *bool   `json:"archived"`
+}
+
+type memberInput struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// 查询清单时连接当前用户的成员记录，取出角色；参数为用户 ID
+const listSelect = `
+	SELECT lists.id, lists.name, lists.owner_id, lists.inbox, lists.archived, list_members.role,
+		(SELECT COUNT(*) FROM todos WHERE todos.list_id = lists.id),
+		(SELECT COUNT(*) FROM todos WHERE todos.list_id = lists.id AND todos.done = 1),
+		lists.created_at
+	FROM lists
+	JOIN list_members ON list_members.list_id = lists.id AND list_members.user_id = ?`
+
+// 用户所在的未归档清单，用于不指定清单时的待办项列表；参数为用户 ID
+const activeLists = `
+	SELECT list_members.list_id FROM list_members
+	JOIN lists ON lists.id = list_members.list_id
+	WHERE list_members.user_id = ? AND lists.archived = 0`
+
+// ===== 工具函数 =====
+
+func scanList(row rowScanner) (List, error) {
+	var list List
+	err := row.Scan(&list.ID, &list.Name, &list.OwnerID, &list.Inbox, &list.Archived, &list.Role,
+		&list.TodoCount, &list.DoneCount, &list.CreatedAt)
+	return list, err
+}
+
+// findList 查询用户所在的清单，不是成员时返回 sql.ErrNoRows
+func findList(q dbtx, listID, userID int) (List, error) {
+	return scanList(q.QueryRow(listSelect+" WHERE lists.id = ?", userID, listID))
+}
+
+func validRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// listRole 返回用户在清单中的角色以及清单是否已归档，不是成员时角色为空
+func listRole(q dbtx, listID, userID int) (role string, archived bool, err error) {
+	err = q.QueryRow(`
+		SELECT list_members.role, lists.archived FROM lists
+		JOIN list_members ON list_members.list_id = lists.id
+		WHERE lists.id = ? AND list_members.user_id = ?`,
+		listID, userID,
+	).Scan(&role, &archived)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return role, archived, err
+}
+
+// inboxID 返回用户收件箱的 ID，不指定清单时新建的待办项放在这里
+func inboxID(q dbtx, userID int) (int, error) {
+	var id int
+	err := q.QueryRow("SELECT id FROM lists WHERE owner_id = ? AND inbox = 1", userID).Scan(&id)
+	return id, err
+}
+
+// createInbox 为新用户创建收件箱
+func createInbox(tx *sql.Tx, userID int64) (int64, error) {
+	result, err := tx.Exec("INSERT INTO lists (name, owner_id, inbox) VALUES ('Inbox', ?, 1)", userID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("INSERT INTO list_members (list_id, user_id, role) VALUES (?, ?, ?)", id, userID, RoleOwner)
+	return id, err
+}
+
+// listScope 解析 /api/lists/{listID}/... 路由中的清单 ID，不在清单路由下时返回 0
+func listScope(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.PathValue("listID")
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		sendError(w, 400, "Invalid list ID format")
+		return 0, false
+	}
+	return id, true
+}
+
+// checkRole 检查角色是否满足要求，不满足时写入错误响应
+// 不是成员按不存在处理（404），避免暴露其他用户的清单
+func checkRole(w http.ResponseWriter, role, need, notFound string) bool {
+	if err := roleError(role, need, notFound); err != nil {
+		sendError(w, err.Code, err.Message)
+		return false
+	}
+	return true
+}
+
+// roleError 角色满足要求时返回 nil，否则返回对应的 404 / 403 错误
+func roleError(role, need, notFound string) *apiError {
+	if role == "" {
+		return &apiError{404, notFound}
+	}
+	if roleRank[role] < roleRank[need] {
+		return &apiError{403, "This action requires the " + need + " role on the list"}
+	}
+	return nil
+}
+
+// authorizeList 检查当前用户在清单中的角色，返回清单是否已归档
+func authorizeList(w http.ResponseWriter, r *http.Request, listID int, need string) (archived bool, ok bool) {
+	role, archived, err := listRole(db, listID, currentUserID(r))
+	if err != nil {
+		log.Println("Error querying list membership:", err)
+		sendError(w, 500, "Failed to check list permissions")
+		return false, false
+	}
+	return archived, checkRole(w, role, need, "List not found")
+}
+
+// authorizeListTodos 检查能否在清单中新建或修改待办项：需要 editor 角色，归档清单只读
+func authorizeListTodos(w http.ResponseWriter, r *http.Request, listID int) bool {
+	archived, ok := authorizeList(w, r, listID, RoleEditor)
+	if ok && archived {
+		sendError(w, 403, "List is archived")
+		return false
+	}
+	return ok
+}
+
+// authorizeTodo 检查当前用户对待办项所在清单的角色，返回待办项所在的清单
+// 在 /api/lists/{listID}/todos/{id} 路由下，待办项必须属于该清单
+func authorizeTodo(w http.ResponseWriter, r *http.Request, todoID int, need string) (int, bool) {
+	scope, ok := listScope(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	listID, role, archived, err := todoRole(db, todoID, currentUserID(r))
+	if err != nil {
+		log.Println("Error querying todo permissions:", err)
+		sendError(w, 500, "Failed to check list permissions")
+		return 0, false
+	}
+	if scope != 0 && scope != listID {
+		role = ""
+	}
+
+	if !checkRole(w, role, need, "Todo not found") {
+		return 0, false
+	}
+	if archived && need != RoleViewer {
+		sendError(w, 403, "List is archived")
+		return 0, false
+	}
+	return listID, true
+}
+
+// todoRole 返回待办项所在的清单、用户在该清单中的角色以及清单是否已归档，不是成员时角色为空
+func todoRole(q dbtx, todoID, userID int) (listID int, role string, archived bool, err error) {
+	err = q.QueryRow(`
+		SELECT todos.list_id, list_members.role, lists.archived FROM todos
+		JOIN lists ON lists.id = todos.list_id
+		JOIN list_members ON list_members.list_id = todos.list_id AND list_members.user_id = ?
+		WHERE todos.id = ?`,
+		userID, todoID,
+	).Scan(&listID, &role, &archived)
+	if err == sql.ErrNoRows {
+		return 0, "", false, nil
+	}
+	return listID, role, archived, err
+}
+
+// targetList 新建待办项或清空已完成项时使用的清单：路由中的清单，否则是收件箱
+func targetList(w http.ResponseWriter, r *http.Request) (int, bool) {
+	listID, ok := listScope(w, r)
+	if !ok || listID != 0 {
+		return listID, ok
+	}
+
+	listID, err := inboxID(db, currentUserID(r))
+	if err != nil {
+		log.Println("Error querying inbox:", err)
+		sendError(w, 500, "Failed to find inbox")
+		return 0, false
+	}
+	return listID, true
+}
+
+// ownerCount 统计清单的 owner 数量，清单至少要保留一个 owner
+func ownerCount(q dbtx, listID int) (int, error) {
+	var n int
+	err := q.QueryRow("SELECT COUNT(*) FROM list_members WHERE list_id = ? AND role = ?", listID, RoleOwner).Scan(&n)
+	return n, err
+}
+
+func listMembers(q dbtx, listID int) ([]ListMember, error) {
+	rows, err := q.Query(`
+		SELECT list_members.user_id, users.username, list_members.role, list_members.created_at
+		FROM list_members JOIN users ON users.id = list_members.user_id
+		WHERE list_members.list_id = ?
+		ORDER BY list_members.created_at, list_members.user_id`,
+		listID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ListMember{}
+	for rows.Next() {
+		var member ListMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// ===== 清单 API =====
+
+// GET /api/lists - 获取当前用户所在的清单，archived=true 时包含已归档的清单
+func getLists(w http.ResponseWriter, r *http.Request) {
+	query := listSelect
+	if r.URL.Query().Get("archived") != "true" {
+		query += " WHERE lists.archived = 0"
+	}
+
+	rows, err := db.Query(query+" ORDER BY lists.inbox DESC, lists.id", currentUserID(r))
+	if err != nil {
+		log.Println("Error querying lists:", err)
+		sendError(w, 500, "Failed to retrieve lists")
+		return
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			log.Println("Error scanning list:", err)
+			continue
+		}
+		lists = append(lists, list)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Println("Error iterating lists:", err)
+		sendError(w, 500, "Error reading lists")
+		return
+	}
+
+	sendJSON(w, 0, "Success", lists)
+}
+
+// POST /api/lists - 创建清单，创建者成为 owner
+func createList(w http.ResponseWriter, r *http.Request) {
+	var input listInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		sendError(w, 400, "Name is required")
+		return
+	}
+
+	userID := currentUserID(r)
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to create list")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO lists (name, owner_id, created_at) VALUES (?, ?, ?)",
+		strings.TrimSpace(*input.Name), userID, formatTime(time.Now()))
+	if err != nil {
+		log.Println("Error inserting list:", err)
+		sendError(w, 500, "Failed to create list")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		sendError(w, 500, "Failed to get inserted ID")
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO list_members (list_id, user_id, role) VALUES (?, ?, ?)", id, userID, RoleOwner)
+	if err != nil {
+		log.Println("Error inserting list owner:", err)
+		sendError(w, 500, "Failed to create list")
+		return
+	}
+
+	list, err := findList(tx, int(id), userID)
+	if err != nil {
+		log.Println("Error reloading list:", err)
+		sendError(w, 500, "Failed to create list")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to create list")
+		return
+	}
+
+	w.Header().Set("Location", "/api/lists/"+strconv.Itoa(list.ID))
+	sendJSONStatus(w, http.StatusCreated, 0, "List created successfully", list)
+}
+
+// GET /api/lists/{listID} - 获取清单详情和成员
+func getList(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := findList(db, listID, currentUserID(r))
+	if err == sql.ErrNoRows {
+		sendError(w, 404, "List not found")
+		return
+	} else if err != nil {
+		log.Println("Error querying list:", err)
+		sendError(w, 500, "Failed to retrieve list")
+		return
+	}
+
+	members, err := listMembers(db, listID)
+	if err != nil {
+		log.Println("Error querying list members:", err)
+		sendError(w, 500, "Failed to retrieve list")
+		return
+	}
+
+	sendJSON(w, 0, "Success", map[string]interface{}{"list": list, "members": members})
+}
+
+// PATCH /api/lists/{listID} - 重命名或归档清单（owner）
+func patchList(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+
+	var input listInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			sendError(w, 400, "Name is required")
+			return
+		}
+		input.Name = &name
+	}
+
+	if _, ok := authorizeList(w, r, listID, RoleOwner); !ok {
+		return
+	}
+
+	list, err := findList(db, listID, currentUserID(r))
+	if err != nil {
+		log.Println("Error querying list:", err)
+		sendError(w, 500, "Failed to update list")
+		return
+	}
+	if list.Inbox && input.Archived != nil && *input.Archived {
+		sendError(w, 400, "Inbox cannot be archived")
+		return
+	}
+
+	_, err = db.Exec("UPDATE lists SET name = COALESCE(?, name), archived = COALESCE(?, archived) WHERE id = ?",
+		input.Name, input.Archived, listID)
+	if err != nil {
+		log.Println("Error updating list:", err)
+		sendError(w, 500, "Failed to update list")
+		return
+	}
+
+	list, err = findList(db, listID, currentUserID(r))
+	if err != nil {
+		log.Println("Error reloading list:", err)
+		sendError(w, 500, "Failed to retrieve list")
+		return
+	}
+
+	sendJSON(w, 0, "List updated successfully", list)
+}
+
+// DELETE /api/lists/{listID} - 删除清单及其中的待办项（owner，收件箱不能删除）
+func deleteList(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeList(w, r, listID, RoleOwner); !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to delete list")
+		return
+	}
+	defer tx.Rollback()
+
+	var inbox bool
+	if err := tx.QueryRow("SELECT inbox FROM lists WHERE id = ?", listID).Scan(&inbox); err != nil {
+		log.Println("Error querying list:", err)
+		sendError(w, 500, "Failed to delete list")
+		return
+	}
+	if inbox {
+		sendError(w, 400, "Inbox cannot be deleted")
+		return
+	}
+
+	// 成员会随清单一起删除，deleted 事件发给删除前的成员
+	members, err := listMembers(tx, listID)
+	if err != nil {
+		log.Println("Error querying list members:", err)
+		sendError(w, 500, "Failed to delete list")
+		return
+	}
+	deleted, err := deleteTodosTx(tx, "list_id = ?", listID)
+	if err != nil {
+		log.Println("Error deleting list todos:", err)
+		sendError(w, 500, "Failed to delete list")
+		return
+	}
+	users := make([]int, 0, len(members))
+	for _, member := range members {
+		users = append(users, member.UserID)
+	}
+	for i := range deleted {
+		deleted[i].users = users
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM list_members WHERE list_id = ?",
+		"DELETE FROM lists WHERE id = ?",
+	} {
+		if _, err := tx.Exec(stmt, listID); err != nil {
+			log.Println("Error deleting list:", err)
+			sendError(w, 500, "Failed to delete list")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to delete list")
+		return
+	}
+	publishTodoEvents(deleted...)
+
+	sendJSON(w, 0, "List deleted successfully", map[string]interface{}{"id": listID, "deleted_todos": len(deleted)})
+}
+
+// ===== 清单成员 API =====
+
+// GET /api/lists/{listID}/members - 获取清单成员
+func getListMembers(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeList(w, r, listID, RoleViewer); !ok {
+		return
+	}
+
+	members, err := listMembers(db, listID)
+	if err != nil {
+		log.Println("Error querying list members:", err)
+		sendError(w, 500, "Failed to retrieve members")
+		return
+	}
+
+	sendJSON(w, 0, "Success", members)
+}
+
+// POST /api/lists/{listID}/members - 按用户名添加成员（owner），role 默认为 editor
+func addListMember(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+
+	var input memberInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if input.Role == "" {
+		input.Role = RoleEditor
+	}
+	if !validRole(input.Role) {
+		sendError(w, 400, "role must be one of owner, editor, viewer")
+		return
+	}
+
+	if _, ok := authorizeList(w, r, listID, RoleOwner); !ok {
+		return
+	}
+
+	var inbox bool
+	if err := db.QueryRow("SELECT inbox FROM lists WHERE id = ?", listID).Scan(&inbox); err != nil {
+		log.Println("Error querying list:", err)
+		sendError(w, 500, "Failed to add member")
+		return
+	}
+	if inbox {
+		sendError(w, 400, "Inbox cannot be shared")
+		return
+	}
+
+	var userID int
+	err := db.QueryRow("SELECT id FROM users WHERE username = ?", strings.TrimSpace(input.Username)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		sendError(w, 404, "User not found")
+		return
+	} else if err != nil {
+		log.Println("Error querying user:", err)
+		sendError(w, 500, "Failed to add member")
+		return
+	}
+
+	result, err := db.Exec("INSERT OR IGNORE INTO list_members (list_id, user_id, role) VALUES (?, ?, ?)",
+		listID, userID, input.Role)
+	if err != nil {
+		log.Println("Error inserting list member:", err)
+		sendError(w, 500, "Failed to add member")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		sendError(w, 409, "User is already a member of this list")
+		return
+	}
+
+	members, err := listMembers(db, listID)
+	if err != nil {
+		log.Println("Error querying list members:", err)
+		sendError(w, 500, "Failed to retrieve members")
+		return
+	}
+
+	sendJSONStatus(w, http.StatusCreated, 0, "Member added successfully", members)
+}
+
+// PATCH /api/lists/{listID}/members/{userID} - 修改成员角色（owner）
+func updateListMember(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		sendError(w, 400, "Invalid user ID format")
+		return
+	}
+
+	var input memberInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if !validRole(input.Role) {
+		sendError(w, 400, "role must be one of owner, editor, viewer")
+		return
+	}
+
+	if _, ok := authorizeList(w, r, listID, RoleOwner); !ok {
+		return
+	}
+
+	changeMembership(w, listID, memberID, "UPDATE list_members SET role = ? WHERE list_id = ? AND user_id = ?",
+		[]interface{}{input.Role, listID, memberID}, input.Role != RoleOwner, "Member updated successfully")
+}
+
+// DELETE /api/lists/{listID}/members/{userID} - 移除成员（owner），成员也可以自己退出
+func removeListMember(w http.ResponseWriter, r *http.Request) {
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		sendError(w, 400, "Invalid user ID format")
+		return
+	}
+
+	need := RoleOwner
+	if memberID == currentUserID(r) {
+		need = RoleViewer
+	}
+	if _, ok := authorizeList(w, r, listID, need); !ok {
+		return
+	}
+
+	changeMembership(w, listID, memberID, "DELETE FROM list_members WHERE list_id = ? AND user_id = ?",
+		[]interface{}{listID, memberID}, true, "Member removed successfully")
+}
+
+// changeMembership 在事务中修改成员记录，dropsOwner 为 true 时确保清单仍至少有一个 owner
+func changeMembership(w http.ResponseWriter, listID, memberID int, stmt string, args []interface{}, dropsOwner bool, message string) {
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to update membership")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(stmt, args...)
+	if err != nil {
+		log.Println("Error updating list member:", err)
+		sendError(w, 500, "Failed to update membership")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		sendError(w, 404, "Member not found")
+		return
+	}
+
+	if dropsOwner {
+		owners, err := ownerCount(tx, listID)
+		if err != nil {
+			log.Println("Error counting list owners:", err)
+			sendError(w, 500, "Failed to update membership")
+			return
+		}
+		if owners == 0 {
+			sendError(w, 409, "A list must keep at least one owner")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to update membership")
+		return
+	}
+
+	sendJSON(w, 0, message, map[string]interface{}{"list_id": listID, "user_id": memberID})
+}
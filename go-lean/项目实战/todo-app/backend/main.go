@@ -1,37 +1,66 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // ===== 数据模型 =====
 type Todo struct {
-	ID    int    `json:"id"`
-	Title string `json:"title"`
-	Desc  string `json:"desc"`
-	Done  bool   `json:"done"`
+	ID           int               `json:"id"`
+	UID          string            `json:"uid"`
+	ListID       int               `json:"list_id"`
+	Position     string            `json:"position"`
+	Title        string            `json:"title"`
+	Desc         string            `json:"desc"`
+	Done         bool              `json:"done"`
+	Priority     string            `json:"priority"`
+	DueAt        *time.Time        `json:"due_at"`
+	CompletedAt  *time.Time        `json:"completed_at"`
+	AutoComplete bool              `json:"auto_complete"`
+	Recurrence   string            `json:"recurrence"`
+	RecurrenceTZ string            `json:"recurrence_tz"`
+	Occurrence   int               `json:"occurrence"`
+	NextID       *int              `json:"next_occurrence_id"`
+	Tags         []string          `json:"tags"`
+	Extensions   map[string]string `json:"extensions"`
+	Checklist    ChecklistProgress `json:"checklist"`
+	Version      int               `json:"version"`
+	CreatedAt    time.Time         `json:"created_at"`
 }
 
 type Response struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Code       int         `json:"code"`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
+// todos 表查询列，与 scanTodo 的字段顺序一致
+const todoColumns = "id, uid, COALESCE(list_id, 0), position, title, COALESCE(desc, ''), done, priority, due_at, completed_at, auto_complete, " +
+	"recurrence, recurrence_tz, occurrence, next_occurrence_id, tags, extensions, " + checklistProgressColumns + ", version, created_at"
+
+// SQLite CURRENT_TIMESTAMP 使用的时间格式（UTC）
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
 // ===== 全局数据库连接 =====
 var db *sql.DB
 
 // ===== 初始化数据库 =====
 func initDB() error {
 	var err error
-	db, err = sql.Open("sqlite3", "todos.db")
+	// 开启外键约束，删除待办项时级联删除提醒
+	db, err = sql.Open("sqlite3", "todos.db?_foreign_keys=on")
 	if err != nil {
 		return err
 	}
@@ -42,27 +71,16 @@ func initDB() error {
 		return err
 	}
 
-	// 创建表
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS todos (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		title TEXT NOT NULL,
-		desc TEXT,
-		done BOOLEAN DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-
-	_, err = db.Exec(createTableSQL)
-	return err
+	return nil
 }
 
 // ===== 中间件：CORS 跨域处理 =====
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Location")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -82,9 +100,19 @@ func loggingMiddleware(next http.Handler) http.Handler {
 }
 
 // ===== 工具函数：返回 JSON 响应 =====
+// code 为 0 时返回 200，否则 code 同时作为 HTTP 状态码
 func sendJSON(w http.ResponseWriter, code int, message string, data interface{}) {
+	status := http.StatusOK
+	if code >= 400 && code < 600 {
+		status = code
+	}
+	sendJSONStatus(w, status, code, message, data)
+}
+
+// ===== 工具函数：以指定 HTTP 状态码返回 JSON 响应 =====
+func sendJSONStatus(w http.ResponseWriter, status int, code int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	resp := Response{
 		Code:    code,
@@ -100,11 +128,187 @@ func sendError(w http.ResponseWriter, code int, message string) {
 	sendJSON(w, code, message, nil)
 }
 
+// ===== 工具函数：带状态码的错误 =====
+// 用于不能直接写响应的场景（如批量操作），Code 即 HTTP 状态码
+type apiError struct {
+	Code    int
+	Message string
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+// ===== 工具函数：按 SQLite CURRENT_TIMESTAMP 的格式写入时间 =====
+func formatTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// ===== 工具函数：扫描一行待办项 =====
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTodo(row rowScanner) (Todo, error) {
+	var todo Todo
+	var priority int
+	var dueAt, completedAt sql.NullTime
+	var next sql.NullInt64
+	var tags, extensions string
+	var itemsTotal, itemsDone int
+	err := row.Scan(&todo.ID, &todo.UID, &todo.ListID, &todo.Position, &todo.Title, &todo.Desc, &todo.Done, &priority, &dueAt, &completedAt,
+		&todo.AutoComplete, &todo.Recurrence, &todo.RecurrenceTZ, &todo.Occurrence, &next, &tags, &extensions,
+		&itemsTotal, &itemsDone, &todo.Version, &todo.CreatedAt)
+	if err != nil {
+		return todo, err
+	}
+	todo.Priority = priorityName(priority)
+	todo.Checklist = newChecklistProgress(itemsTotal, itemsDone)
+	todo.DueAt = timePtr(dueAt)
+	todo.CompletedAt = timePtr(completedAt)
+	if next.Valid {
+		id := int(next.Int64)
+		todo.NextID = &id
+	}
+	return todo, scanTags(&todo, tags, extensions)
+}
+
+// findTodo 查询用户所在清单中的待办项，不存在时返回 sql.ErrNoRows
+func findTodo(id, userID int) (Todo, error) {
+	return loadTodo(db, id, userID)
+}
+
+func loadTodo(q dbtx, id, userID int) (Todo, error) {
+	return scanTodo(q.QueryRow(
+		"SELECT "+todoColumns+" FROM todos WHERE id = ? AND list_id IN (SELECT list_id FROM list_members WHERE user_id = ?)",
+		id, userID,
+	))
+}
+
+// validateTodo 检查标题、优先级、重复规则和标签（改写为规范形式），返回优先级对应的数值
+func validateTodo(todo *Todo) (int, error) {
+	if todo.Title == "" {
+		return 0, errors.New("Title is required")
+	}
+	if err := normalizeRecurrence(todo); err != nil {
+		return 0, err
+	}
+	if err := normalizeTags(todo); err != nil {
+		return 0, err
+	}
+	return priorityLevel(todo.Priority)
+}
+
+// insertTodo 插入新的待办项（第一次出现），填充 ID、创建时间和完成时间，没有 UID 时生成一个
+func insertTodo(q dbtx, todo *Todo, priority, userID int) error {
+	if todo.UID == "" {
+		uid, err := newTodoUID()
+		if err != nil {
+			return err
+		}
+		todo.UID = uid
+	}
+	todo.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	todo.CompletedAt = nil
+	if todo.Done {
+		todo.CompletedAt = &todo.CreatedAt
+	}
+	todo.Occurrence = 1
+	todo.NextID = nil
+	result, err := q.Exec(
+		"INSERT INTO todos (uid, list_id, position, title, desc, done, priority, due_at, completed_at, auto_complete, recurrence, recurrence_tz, tags, extensions, user_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		todo.UID,
+		todo.ListID,
+		todo.Position,
+		todo.Title,
+		todo.Desc,
+		todo.Done,
+		priority,
+		nullableTime(todo.DueAt),
+		nullableTime(todo.CompletedAt),
+		todo.AutoComplete,
+		todo.Recurrence,
+		todo.RecurrenceTZ,
+		tagsJSON(todo.Tags),
+		extensionsJSON(todo.Extensions),
+		userID,
+		formatTime(todo.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	todo.ID = int(id)
+	todo.Version = 1
+	todo.Checklist = newChecklistProgress(0, 0)
+	return err
+}
+
+// 修改待办项的语句，参数依次为 list_id, position（nil 保持不变）, title, desc, done, priority, due_at, auto_complete,
+// recurrence, recurrence_tz, tags, extensions, done, 当前时间, id, 读取时的版本号
+const updateTodoSQL = "UPDATE todos SET list_id = ?, position = COALESCE(?, position), title = ?, desc = ?, done = ?, priority = ?, due_at = ?, auto_complete = ?, " +
+	"recurrence = ?, recurrence_tz = ?, tags = ?, extensions = ?, " +
+	completedAtUpdate + ", version = version + 1 WHERE id = ? AND version = ?"
+
+// execTodoUpdate 把 todo 写回数据库，已完成的待办项保留原来的完成时间
+// todo.Version 为读取时的版本号，期间被其他请求修改过时影响行数为 0
+func execTodoUpdate(q dbtx, id int, todo Todo, priority int, position interface{}) (sql.Result, error) {
+	return q.Exec(
+		updateTodoSQL,
+		todo.ListID,
+		position,
+		todo.Title,
+		todo.Desc,
+		todo.Done,
+		priority,
+		nullableTime(todo.DueAt),
+		todo.AutoComplete,
+		todo.Recurrence,
+		todo.RecurrenceTZ,
+		tagsJSON(todo.Tags),
+		extensionsJSON(todo.Extensions),
+		todo.Done,
+		formatTime(time.Now()),
+		id,
+		todo.Version,
+	)
+}
+
+// toggleTodoDone 在一条语句中切换状态并设置或清空完成时间
+// expected 不为 0 时只在版本号等于 expected 时切换，否则返回 sql.ErrNoRows
+func toggleTodoDone(q dbtx, id, expected int) (done bool, completedAt sql.NullTime, version int, err error) {
+	err = q.QueryRow(`
+		UPDATE todos SET done = NOT done, completed_at = CASE WHEN done THEN NULL ELSE ? END, version = version + 1
+		WHERE id = ? AND (? = 0 OR version = ?)
+		RETURNING done, completed_at, version`,
+		formatTime(time.Now()), id, expected, expected,
+	).Scan(&done, &completedAt, &version)
+	return done, completedAt, version, err
+}
+
 // ===== API 处理器 =====
 
-// GET /api/todos - 获取所有待办项
+// GET /api/todos - 获取待办项列表（支持过滤、排序和游标分页）
+// GET /api/lists/{listID}/todos - 只获取指定清单中的待办项
 func getTodos(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, title, desc, done FROM todos ORDER BY id DESC")
+	query, err := parseListQuery(r)
+	if err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+
+	listID, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	if listID != 0 {
+		if _, ok := authorizeList(w, r, listID, RoleViewer); !ok {
+			return
+		}
+	}
+	query.ListID = listID
+
+	clause, args := buildListSQL(currentUserID(r), query)
+	rows, err := db.Query("SELECT "+todoColumns+" FROM todos"+clause, args...)
 	if err != nil {
 		log.Println("Error querying todos:", err)
 		sendError(w, 500, "Failed to retrieve todos")
@@ -114,8 +318,7 @@ func getTodos(w http.ResponseWriter, r *http.Request) {
 
 	todos := []Todo{}
 	for rows.Next() {
-		var todo Todo
-		err := rows.Scan(&todo.ID, &todo.Title, &todo.Desc, &todo.Done)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			log.Println("Error scanning todo:", err)
 			continue
@@ -129,26 +332,36 @@ func getTodos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 如果没有结果，返回空数组而不是 null
-	if todos == nil {
-		todos = []Todo{}
+	// 多取的一条说明还有下一页
+	next := ""
+	if len(todos) > query.Limit {
+		todos = todos[:query.Limit]
+		next = nextCursor(query, todos[len(todos)-1])
 	}
 
-	sendJSON(w, 0, "Success", todos)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{
+		Code:       0,
+		Message:    "Success",
+		Data:       todos,
+		NextCursor: next,
+	})
 }
 
 // GET /api/todos/{id} - 获取单个待办项
 func getTodoByID(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		sendError(w, 400, "Invalid ID format")
 		return
 	}
 
-	var todo Todo
-	err = db.QueryRow("SELECT id, title, desc, done FROM todos WHERE id = ?", id).
-		Scan(&todo.ID, &todo.Title, &todo.Desc, &todo.Done)
+	if _, ok := authorizeTodo(w, r, id, RoleViewer); !ok {
+		return
+	}
+
+	todo, err := findTodo(id, currentUserID(r))
 
 	if err == sql.ErrNoRows {
 		sendError(w, 404, "Todo not found")
@@ -159,6 +372,15 @@ func getTodoByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 客户端缓存的版本仍是最新时返回 304
+	etag := todoETag(todo.Version)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Patch", mergePatchContentType)
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	sendJSON(w, 0, "Success", todo)
 }
 
@@ -174,38 +396,56 @@ func createTodo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证输入
-	if todo.Title == "" {
-		sendError(w, 400, "Title is required")
+	priority, err := validateTodo(&todo)
+	if err != nil {
+		sendError(w, 400, err.Error())
 		return
 	}
+	todo.Priority = priorityName(priority)
 
-	// 插入数据库
-	result, err := db.Exec(
-		"INSERT INTO todos (title, desc, done) VALUES (?, ?, ?)",
-		todo.Title,
-		todo.Desc,
-		todo.Done,
-	)
+	// 路由中的清单优先，其次是请求体中的 list_id，都没有时放入收件箱
+	scope, ok := listScope(w, r)
+	if !ok {
+		return
+	}
+	if scope != 0 {
+		todo.ListID = scope
+	}
+	if todo.ListID == 0 {
+		if todo.ListID, ok = targetList(w, r); !ok {
+			return
+		}
+	}
+	if !authorizeListTodos(w, r, todo.ListID) {
+		return
+	}
 
+	// 新建的待办项放在清单最前面
+	todo.Position, err = topPosition(todo.ListID)
 	if err != nil {
-		log.Println("Error inserting todo:", err)
+		log.Println("Error computing position:", err)
 		sendError(w, 500, "Failed to create todo")
 		return
 	}
 
-	id, err := result.LastInsertId()
+	// 插入数据库
+	err = insertTodo(db, &todo, priority, currentUserID(r))
 	if err != nil {
-		sendError(w, 500, "Failed to get inserted ID")
+		log.Println("Error inserting todo:", err)
+		sendError(w, 500, "Failed to create todo")
 		return
 	}
 
-	todo.ID = int(id)
-	sendJSON(w, 0, "Todo created successfully", todo)
+	publishTodoEvents(newTodoEvent("created", todo.ID))
+
+	w.Header().Set("Location", fmt.Sprintf("/api/todos/%d", todo.ID))
+	w.Header().Set("ETag", todoETag(todo.Version))
+	sendJSONStatus(w, http.StatusCreated, 0, "Todo created successfully", todo)
 }
 
 // PUT /api/todos/{id} - 更新待办项
 func updateTodo(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		sendError(w, 400, "Invalid ID format")
@@ -219,20 +459,49 @@ func updateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 先检查权限：没有权限的调用者得到 404，而不是验证错误
+	listID, ok := authorizeTodo(w, r, id, RoleEditor)
+	if !ok {
+		return
+	}
+
 	// 验证输入
-	if todo.Title == "" {
-		sendError(w, 400, "Title is required")
+	priority, err := validateTodo(&todo)
+	if err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+	// list_id 不为 0 且与当前清单不同时，把待办项移到该清单的最前面
+	target := listID
+	if todo.ListID != 0 && todo.ListID != listID {
+		if !authorizeListTodos(w, r, todo.ListID) {
+			return
+		}
+		target = todo.ListID
+	}
+	// 带 If-Match 时必须与当前版本一致
+	current, err := findTodo(id, currentUserID(r))
+	if err == sql.ErrNoRows {
+		sendError(w, 404, "Todo not found")
+		return
+	} else if err != nil {
+		log.Println("Error querying todo:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return
+	}
+	if !checkIfMatch(w, r, current.Version) {
 		return
 	}
 
-	// 更新数据库
-	result, err := db.Exec(
-		"UPDATE todos SET title = ?, desc = ?, done = ? WHERE id = ?",
-		todo.Title,
-		todo.Desc,
-		todo.Done,
-		id,
-	)
+	position, ok := movedPosition(w, listID, target)
+	if !ok {
+		return
+	}
+
+	// 更新数据库，已完成的待办项保留原来的完成时间
+	todo.ListID = target
+	todo.Version = current.Version
+	result, err := execTodoUpdate(db, id, todo, priority, position)
 
 	if err != nil {
 		log.Println("Error updating todo:", err)
@@ -246,28 +515,99 @@ func updateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 读取之后被其他请求修改过
 	if rowsAffected == 0 {
-		sendError(w, 404, "Todo not found")
+		sendPreconditionFailed(w, 0)
 		return
 	}
 
-	todo.ID = id
+	event := newTodoEvent("updated", id)
+	if target != listID {
+		event.FromListID = listID
+	}
+	publishTodoEvents(event)
+
+	todo, err = findTodo(id, currentUserID(r))
+	if err != nil {
+		log.Println("Error reloading todo:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return
+	}
+
+	w.Header().Set("ETag", todoETag(todo.Version))
 	sendJSON(w, 0, "Todo updated successfully", todo)
 }
 
-// DELETE /api/todos/{id} - 删除待办项
-func deleteTodo(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+// completedAtUpdate 根据 done 设置或清空完成时间，参数依次为 done 和当前时间
+const completedAtUpdate = "completed_at = CASE WHEN ? THEN COALESCE(completed_at, ?) ELSE NULL END"
+
+// PATCH /api/todos/{id} - 部分更新待办项（JSON Merge Patch，RFC 7396）
+func patchTodo(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		sendError(w, 400, "Invalid ID format")
 		return
 	}
 
-	result, err := db.Exec("DELETE FROM todos WHERE id = ?", id)
+	if !checkMergePatchType(w, r) {
+		return
+	}
+	var patch json.RawMessage
+	err = json.NewDecoder(r.Body).Decode(&patch)
 	if err != nil {
-		log.Println("Error deleting todo:", err)
-		sendError(w, 500, "Failed to delete todo")
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+
+	listID, ok := authorizeTodo(w, r, id, RoleEditor)
+	if !ok {
+		return
+	}
+
+	todo, err := findTodo(id, currentUserID(r))
+
+	if err == sql.ErrNoRows {
+		sendError(w, 404, "Todo not found")
+		return
+	} else if err != nil {
+		log.Println("Error querying todo:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return
+	}
+	if !checkIfMatch(w, r, todo.Version) {
+		return
+	}
+
+	todo, err = mergeTodo(todo, patch)
+	if apiErr, ok := err.(*apiError); ok {
+		sendError(w, apiErr.Code, apiErr.Message)
+		return
+	} else if err != nil {
+		log.Println("Error merging patch:", err)
+		sendError(w, 500, "Failed to update todo")
+		return
+	}
+	if todo.ListID != listID && !authorizeListTodos(w, r, todo.ListID) {
+		return
+	}
+
+	// 验证合并后的结果
+	priority, err := validateTodo(&todo)
+	if err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+	position, ok := movedPosition(w, listID, todo.ListID)
+	if !ok {
+		return
+	}
+
+	result, err := execTodoUpdate(db, id, todo, priority, position)
+
+	if err != nil {
+		log.Println("Error updating todo:", err)
+		sendError(w, 500, "Failed to update todo")
 		return
 	}
 
@@ -277,55 +617,171 @@ func deleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 读取之后被其他请求修改过
 	if rowsAffected == 0 {
+		sendPreconditionFailed(w, 0)
+		return
+	}
+
+	event := newTodoEvent("updated", id)
+	if todo.ListID != listID {
+		event.FromListID = listID
+	}
+	publishTodoEvents(event)
+
+	todo, err = findTodo(id, currentUserID(r))
+	if err != nil {
+		log.Println("Error reloading todo:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return
+	}
+
+	w.Header().Set("ETag", todoETag(todo.Version))
+	sendJSON(w, 0, "Todo updated successfully", todo)
+}
+
+// DELETE /api/todos/{id} - 删除待办项及其检查项
+func deleteTodo(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		sendError(w, 400, "Invalid ID format")
+		return
+	}
+
+	if _, ok := authorizeTodo(w, r, id, RoleEditor); !ok {
+		return
+	}
+
+	expected, ok := ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	var deleted []todoEvent
+	if expected != 0 {
+		deleted, err = deleteTodosWhere("id = ? AND version = ?", id, expected)
+	} else {
+		deleted, err = deleteTodosWhere("id = ?", id)
+	}
+	if err != nil {
+		log.Println("Error deleting todo:", err)
+		sendError(w, 500, "Failed to delete todo")
+		return
+	}
+
+	if len(deleted) == 0 && expected != 0 {
+		sendPreconditionFailed(w, 0)
+		return
+	}
+	if len(deleted) == 0 {
 		sendError(w, 404, "Todo not found")
 		return
 	}
+	publishTodoEvents(deleted...)
 
 	sendJSON(w, 0, "Todo deleted successfully", map[string]interface{}{"id": id})
 }
 
-// DELETE /api/todos - 清空所有完成的任务
+// DELETE /api/todos - 清空收件箱中所有完成的任务
+// DELETE /api/lists/{listID}/todos - 清空指定清单中所有完成的任务
 func deleteDoneTodos(w http.ResponseWriter, r *http.Request) {
-	result, err := db.Exec("DELETE FROM todos WHERE done = 1")
+	listID, ok := targetList(w, r)
+	if !ok || !authorizeListTodos(w, r, listID) {
+		return
+	}
+
+	deleted, err := deleteTodosWhere("done = 1 AND list_id = ?", listID)
 	if err != nil {
 		log.Println("Error deleting done todos:", err)
 		sendError(w, 500, "Failed to delete done todos")
 		return
 	}
+	publishTodoEvents(deleted...)
 
-	rowsAffected, _ := result.RowsAffected()
-	sendJSON(w, 0, "Done todos deleted", map[string]interface{}{"deleted": rowsAffected})
+	sendJSON(w, 0, "Done todos deleted", map[string]interface{}{"list_id": listID, "deleted": len(deleted)})
 }
 
 // POST /api/todos/{id}/toggle - 切换完成状态
 func toggleTodo(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		sendError(w, 400, "Invalid ID format")
 		return
 	}
 
-	// 查询当前状态
-	var done bool
-	err = db.QueryRow("SELECT done FROM todos WHERE id = ?", id).Scan(&done)
-	if err == sql.ErrNoRows {
+	if _, ok := authorizeTodo(w, r, id, RoleEditor); !ok {
+		return
+	}
+
+	// 带 If-Match 时只在版本号未变化时切换
+	expected, ok := ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to toggle todo")
+		return
+	}
+	defer tx.Rollback()
+
+	done, completedAt, version, err := toggleTodoDone(tx, id, expected)
+	if err == sql.ErrNoRows && expected != 0 {
+		sendPreconditionFailed(w, 0)
+		return
+	} else if err == sql.ErrNoRows {
 		sendError(w, 404, "Todo not found")
 		return
 	} else if err != nil {
-		sendError(w, 500, "Failed to query todo")
+		log.Println("Error toggling todo:", err)
+		sendError(w, 500, "Failed to toggle todo")
 		return
 	}
 
-	// 更新状态
-	_, err = db.Exec("UPDATE todos SET done = ? WHERE id = ?", !done, id)
+	// 完成重复待办项时生成下一次，记录 next_occurrence_id 会让版本号再加 1
+	var next *Todo
+	nextID, err := spawnNextOccurrence(tx, id)
+	if err == nil && nextID != 0 {
+		version++
+		var todo Todo
+		todo, err = loadTodo(tx, nextID, currentUserID(r))
+		next = &todo
+	}
 	if err != nil {
+		log.Println("Error creating next occurrence:", err)
 		sendError(w, 500, "Failed to toggle todo")
 		return
 	}
 
-	sendJSON(w, 0, "Todo toggled", map[string]interface{}{"id": id, "done": !done})
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to toggle todo")
+		return
+	}
+
+	publishTodoEvents(newTodoEvent("toggled", id))
+	if next != nil {
+		publishTodoEvents(newTodoEvent("created", next.ID))
+	}
+
+	w.Header().Set("ETag", todoETag(version))
+	sendJSON(w, 0, "Todo toggled", map[string]interface{}{
+		"id":           id,
+		"done":         done,
+		"completed_at": timePtr(completedAt),
+		"version":      version,
+		"next":         next,
+	})
+}
+
+// ===== 兼容旧版路由：把 ?id=N 转成路径参数 =====
+func legacyIDRoute(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", r.URL.Query().Get("id"))
+		handler(w, r)
+	}
 }
 
 // ===== 路由配置 =====
@@ -337,70 +793,127 @@ func main() {
 	}
 	defer db.Close()
 
-	log.Println("Database initialized successfully")
+	// migrate 子命令：todo-app migrate up | down [N] | status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
 
-	// 创建 HTTP 服务器多路复用器
-	mux := http.NewServeMux()
+	// 启动时执行未执行的迁移，数据库版本比程序新时拒绝启动
+	err = applyMigrations()
+	if err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 
-	// 注册 API 路由
-	mux.HandleFunc("/api/todos", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			getTodos(w, r)
-		} else if r.Method == http.MethodPost {
-			createTodo(w, r)
-		} else if r.Method == http.MethodDelete {
-			deleteDoneTodos(w, r)
-		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})
+	log.Println("Database initialized successfully")
 
-	mux.HandleFunc("/api/todos/detail", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			getTodoByID(w, r)
-		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})
+	// 后台记录即将到期的提醒
+	startReminderScheduler(context.Background())
 
-	mux.HandleFunc("/api/todos/update", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut {
-			updateTodo(w, r)
-		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})
+	// 创建 HTTP 服务器多路复用器（使用 Go 1.22 的方法和路径通配符匹配）
+	mux := http.NewServeMux()
 
-	mux.HandleFunc("/api/todos/delete", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodDelete {
-			deleteTodo(w, r)
-		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})
+	// 注册认证路由
+	mux.HandleFunc("POST /api/auth/register", register)
+	mux.HandleFunc("POST /api/auth/login", login)
+	mux.HandleFunc("POST /api/auth/logout", logout)
+	mux.HandleFunc("GET /api/auth/me", getCurrentUser)
 
-	mux.HandleFunc("/api/todos/toggle", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			toggleTodo(w, r)
-		} else {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	})
+	// 注册 API 路由
+	// 待办项路由同时挂在 /api/lists/{listID}/todos 下，限定在指定清单内
+	for _, prefix := range []string{"/api/todos", "/api/lists/{listID}/todos"} {
+		mux.HandleFunc("GET "+prefix, getTodos)
+		mux.HandleFunc("POST "+prefix, createTodo)
+		mux.HandleFunc("POST "+prefix+"/batch", batchTodos)
+		mux.HandleFunc("GET "+prefix+".ics", exportTodosICS)
+		mux.HandleFunc("GET "+prefix+".txt", exportTodoTxt)
+		mux.HandleFunc("POST "+prefix+"/import", importTodos)
+		mux.HandleFunc("DELETE "+prefix, deleteDoneTodos)
+		mux.HandleFunc("GET "+prefix+"/events", streamTodoEvents)
+		mux.HandleFunc("GET "+prefix+"/overdue", withDue("overdue", getTodos))
+		mux.HandleFunc("GET "+prefix+"/due-today", withDue("today", getTodos))
+		mux.HandleFunc("GET "+prefix+"/{id}", getTodoByID)
+		mux.HandleFunc("PUT "+prefix+"/{id}", updateTodo)
+		mux.HandleFunc("PATCH "+prefix+"/{id}", patchTodo)
+		mux.HandleFunc("DELETE "+prefix+"/{id}", deleteTodo)
+		mux.HandleFunc("POST "+prefix+"/{id}/toggle", toggleTodo)
+		mux.HandleFunc("POST "+prefix+"/{id}/move", moveTodo)
+		mux.HandleFunc("GET "+prefix+"/{id}/items", getChecklistItems)
+		mux.HandleFunc("POST "+prefix+"/{id}/items", createChecklistItem)
+		mux.HandleFunc("PUT "+prefix+"/{id}/items/order", reorderChecklistItems)
+		mux.HandleFunc("PATCH "+prefix+"/{id}/items/{itemID}", patchChecklistItem)
+		mux.HandleFunc("DELETE "+prefix+"/{id}/items/{itemID}", deleteChecklistItem)
+		mux.HandleFunc("POST "+prefix+"/{id}/items/{itemID}/toggle", toggleChecklistItem)
+	}
+
+	// 清单和成员
+	mux.HandleFunc("GET /api/lists", getLists)
+	mux.HandleFunc("POST /api/lists", createList)
+	mux.HandleFunc("GET /api/lists/{listID}", getList)
+	mux.HandleFunc("PATCH /api/lists/{listID}", patchList)
+	mux.HandleFunc("DELETE /api/lists/{listID}", deleteList)
+	mux.HandleFunc("GET /api/lists/{listID}/members", getListMembers)
+	mux.HandleFunc("POST /api/lists/{listID}/members", addListMember)
+	mux.HandleFunc("PATCH /api/lists/{listID}/members/{userID}", updateListMember)
+	mux.HandleFunc("DELETE /api/lists/{listID}/members/{userID}", removeListMember)
+
+	mux.HandleFunc("GET /api/reminders", getReminders)
+
+	// 离线客户端的增量同步
+	mux.HandleFunc("GET /api/sync", getSyncChanges)
+	mux.HandleFunc("POST /api/sync", postSyncChanges)
+
+	// 兼容旧版查询参数路由，迁移完成后删除
+	mux.HandleFunc("GET /api/todos/detail", legacyIDRoute(getTodoByID))
+	mux.HandleFunc("PUT /api/todos/update", legacyIDRoute(updateTodo))
+	mux.HandleFunc("DELETE /api/todos/delete", legacyIDRoute(deleteTodo))
+	mux.HandleFunc("POST /api/todos/toggle", legacyIDRoute(toggleTodo))
 
 	// 应用中间件
-	handler := corsMiddleware(loggingMiddleware(mux))
+	handler := corsMiddleware(loggingMiddleware(authMiddleware(mux)))
 
 	// 启动服务器
 	port := ":8080"
 	log.Printf("Server starting on http://localhost%s", port)
 	log.Printf("API Documentation:\n")
+	log.Printf("  POST   /api/auth/register      - Register user\n")
+	log.Printf("  POST   /api/auth/login         - Log in and get bearer token\n")
+	log.Printf("  POST   /api/auth/logout        - Revoke bearer token\n")
+	log.Printf("  GET    /api/auth/me            - Get current user\n")
 	log.Printf("  GET    /api/todos              - Get all todos\n")
-	log.Printf("  GET    /api/todos/detail?id=N - Get todo by ID\n")
+	log.Printf("  GET    /api/todos/overdue      - Get overdue todos\n")
+	log.Printf("  GET    /api/todos/due-today    - Get todos due today\n")
+	log.Printf("  GET    /api/todos/events       - Stream todo changes (Server-Sent Events)\n")
+	log.Printf("  GET    /api/todos/{id}         - Get todo by ID\n")
 	log.Printf("  POST   /api/todos              - Create todo\n")
-	log.Printf("  PUT    /api/todos/update?id=N - Update todo\n")
-	log.Printf("  DELETE /api/todos/delete?id=N - Delete todo\n")
-	log.Printf("  POST   /api/todos/toggle?id=N - Toggle todo status\n")
+	log.Printf("  PUT    /api/todos/{id}         - Update todo\n")
+	log.Printf("  PATCH  /api/todos/{id}         - Partially update todo\n")
+	log.Printf("  DELETE /api/todos/{id}         - Delete todo\n")
+	log.Printf("  POST   /api/todos/{id}/toggle  - Toggle todo status\n")
+	log.Printf("  POST   /api/todos/{id}/move    - Move todo between neighbors\n")
+	log.Printf("  POST   /api/todos/batch        - Run batch operations in one transaction\n")
+	log.Printf("  GET    /api/todos/{id}/items   - Get checklist items\n")
+	log.Printf("  POST   /api/todos/{id}/items   - Add checklist item\n")
+	log.Printf("  PUT    /api/todos/{id}/items/order - Reorder checklist items\n")
+	log.Printf("  PATCH  /api/todos/{id}/items/{itemID} - Update checklist item\n")
+	log.Printf("  DELETE /api/todos/{id}/items/{itemID} - Delete checklist item\n")
+	log.Printf("  POST   /api/todos/{id}/items/{itemID}/toggle - Toggle checklist item\n")
 	log.Printf("  DELETE /api/todos              - Delete all done todos\n")
+	log.Printf("  GET    /api/reminders          - Get reminders\n")
+	log.Printf("  GET    /api/sync?since=TOKEN   - Get changes since a sync token\n")
+	log.Printf("  POST   /api/sync               - Upload offline changes, resolve conflicts\n")
+	log.Printf("  GET    /api/lists              - Get lists\n")
+	log.Printf("  POST   /api/lists              - Create list\n")
+	log.Printf("  GET    /api/lists/{listID}     - Get list with members\n")
+	log.Printf("  PATCH  /api/lists/{listID}     - Rename or archive list\n")
+	log.Printf("  DELETE /api/lists/{listID}     - Delete list and its todos\n")
+	log.Printf("  GET    /api/lists/{listID}/members - Get list members\n")
+	log.Printf("  POST   /api/lists/{listID}/members - Add list member\n")
+	log.Printf("  PATCH  /api/lists/{listID}/members/{userID} - Change member role\n")
+	log.Printf("  DELETE /api/lists/{listID}/members/{userID} - Remove member\n")
+	log.Printf("  *      /api/lists/{listID}/todos/... - Todo routes scoped to a list\n")
 
 	err = http.ListenAndServe(port, handler)
 	if err != nil {
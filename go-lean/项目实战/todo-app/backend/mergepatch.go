@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// ===== JSON Merge Patch（RFC 7396）=====
+//
+// PATCH 请求体按 RFC 7396 合并到待办项当前的 JSON 表示上：
+// 未出现的字段保持不变，值为 null 的字段被删除（恢复为默认值，例如 due_at 清空、priority 恢复 normal），
+// 对象以外的值直接替换。合并后的结果再按创建时的规则验证。
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// 可以通过 PATCH 修改的字段
+var todoWritableFields = map[string]bool{
+	"list_id":       true,
+	"title":         true,
+	"desc":          true,
+	"done":          true,
+	"priority":      true,
+	"due_at":        true,
+	"auto_complete": true,
+	"recurrence":    true,
+	"recurrence_tz": true,
+	"tags":          true,
+	"extensions":    true,
+}
+
+// 只读字段：合并后的值必须与原来相同，方便客户端把 GET 得到的整个对象修改后发回
+var todoReadOnlyFields = map[string]bool{
+	"id":                 true,
+	"uid":                true,
+	"position":           true,
+	"completed_at":       true,
+	"occurrence":         true,
+	"next_occurrence_id": true,
+	"checklist":          true,
+	"version":            true,
+	"created_at":         true,
+}
+
+// mergePatch 按 RFC 7396 把 patch 合并到 target，返回合并后的值
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// mergeTodo 把 merge patch 应用到 todo 上，返回合并后的待办项（尚未验证标题和优先级）
+// 请求体不是对象、包含未知字段、修改只读字段或类型错误时返回 400
+func mergeTodo(todo Todo, body []byte) (Todo, error) {
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return todo, &apiError{400, "Merge patch must be a JSON object"}
+	}
+
+	names := make([]string, 0, len(patch))
+	for name := range patch {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !todoWritableFields[name] && !todoReadOnlyFields[name] {
+			return todo, &apiError{400, "Unknown field: " + name}
+		}
+	}
+
+	original, err := toJSONObject(todo)
+	if err != nil {
+		return todo, err
+	}
+	target, err := toJSONObject(todo)
+	if err != nil {
+		return todo, err
+	}
+	merged := mergePatch(target, patch).(map[string]interface{})
+
+	for _, name := range names {
+		if todoReadOnlyFields[name] && !reflect.DeepEqual(original[name], merged[name]) {
+			return todo, &apiError{400, name + " is read-only"}
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return todo, err
+	}
+	var result Todo
+	if err := json.Unmarshal(data, &result); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return todo, &apiError{400, "Invalid value for " + typeErr.Field}
+		}
+		return todo, &apiError{400, "Invalid merge patch"}
+	}
+	if result.ListID == 0 {
+		return todo, &apiError{400, "list_id cannot be removed"}
+	}
+	return result, nil
+}
+
+// toJSONObject 把值转换成 JSON 对象（map），与客户端看到的表示一致
+func toJSONObject(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	err = json.Unmarshal(data, &object)
+	return object, err
+}
+
+// checkMergePatchType 只接受 application/merge-patch+json，兼容不带 Content-Type 或 application/json 的旧客户端
+func checkMergePatchType(w http.ResponseWriter, r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == mergePatchContentType || mediaType == "application/json") {
+		return true
+	}
+	w.Header().Set("Accept-Patch", mergePatchContentType)
+	sendError(w, 415, "Content-Type must be "+mergePatchContentType)
+	return false
+}
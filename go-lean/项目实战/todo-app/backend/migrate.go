@@ -0,0 +1,410 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== 数据库迁移 =====
+//
+// 迁移文件位于 migrations/ 目录，编译时嵌入二进制：
+//
+//	NNNN_name.up.sql    升级
+//	NNNN_name.down.sql  回滚
+//
+// 已执行的版本记录在 schema_migrations 表中，每个迁移在独立事务中执行。
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type appliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// loadMigrations 读取嵌入的迁移文件，按版本号排序
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", file)
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.%s.sql", file, direction)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration file %s has invalid version %q", file, prefix)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ensureMigrationsTable 创建 schema_migrations 表
+// 引入迁移之前创建的数据库已经有表结构，按现有结构补记对应版本
+func ensureMigrationsTable() error {
+	exists, err := tableExists("schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+
+	legacy, err := legacyBaseline()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range legacy {
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// legacyBaseline 判断旧数据库已经具备哪些迁移的表结构
+func legacyBaseline() ([]migration, error) {
+	var baseline []migration
+
+	hasTodos, err := tableExists("todos")
+	if err != nil || !hasTodos {
+		return nil, err
+	}
+	baseline = append(baseline, migration{Version: 1, Name: "create_todos"})
+
+	hasUsers, err := tableExists("users")
+	if err != nil {
+		return nil, err
+	}
+	hasOwner, err := columnExists("todos", "user_id")
+	if err != nil {
+		return nil, err
+	}
+	if hasUsers && hasOwner {
+		baseline = append(baseline, migration{Version: 2, Name: "users_and_sessions"})
+	}
+
+	return baseline, nil
+}
+
+func tableExists(name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", name).
+		Scan(&exists)
+	return exists, err
+}
+
+func columnExists(table, column string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", table, column).
+		Scan(&exists)
+	return exists, err
+}
+
+// appliedMigrations 返回已执行的迁移，按版本号排序
+func appliedMigrations() ([]appliedMigration, error) {
+	rows, err := db.Query("SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var m appliedMigration
+		if err := rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+// checkSchemaVersion 数据库版本比程序新时拒绝启动，避免旧程序写坏新结构
+func checkSchemaVersion(migrations []migration) error {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for _, m := range applied {
+		if !known[m.Version] {
+			return fmt.Errorf("database has migration %04d_%s which this binary does not know about; "+
+				"upgrade the binary or roll back with a newer one", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// runMigration 在事务中执行一个迁移并更新 schema_migrations
+func runMigration(m migration, up bool) error {
+	script := m.Up
+	if !up {
+		script = m.Down
+		if strings.TrimSpace(script) == "" {
+			return fmt.Errorf("migration %04d_%s cannot be rolled back: no down file", m.Version, m.Name)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateUp 执行所有未执行的迁移，返回执行的迁移
+func migrateUp(migrations []migration) ([]migration, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	done := map[int]bool{}
+	for _, m := range applied {
+		done[m.Version] = true
+	}
+
+	var ran []migration
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		if err := runMigration(m, true); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// migrateDown 按版本号从新到旧回滚 n 个迁移
+func migrateDown(migrations []migration, n int) ([]migration, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	var reverted []migration
+	for i := len(applied) - 1; i >= 0 && len(reverted) < n; i-- {
+		m, ok := byVersion[applied[i].Version]
+		if !ok {
+			return reverted, fmt.Errorf("migration %04d_%s is not known to this binary", applied[i].Version, applied[i].Name)
+		}
+		if err := runMigration(m, false); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// printMigrationStatus 输出每个迁移的执行状态
+func printMigrationStatus(w io.Writer, migrations []migration) error {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	appliedAt := map[int]time.Time{}
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt
+	}
+
+	for _, m := range migrations {
+		state := "pending"
+		if at, ok := appliedAt[m.Version]; ok {
+			state = "applied " + formatTime(at)
+		}
+		fmt.Fprintf(w, "%04d_%-30s %s\n", m.Version, m.Name, state)
+	}
+
+	// 数据库中存在但程序不认识的迁移（数据库比程序新）
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for _, m := range applied {
+		if !known[m.Version] {
+			fmt.Fprintf(w, "%04d_%-30s applied %s (unknown to this binary)\n", m.Version, m.Name, formatTime(m.AppliedAt))
+		}
+	}
+	return nil
+}
+
+// runMigrateCommand 处理 migrate 子命令：up | down [N] | status
+func runMigrateCommand(args []string, out io.Writer) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return err
+	}
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		if err := checkSchemaVersion(migrations); err != nil {
+			return err
+		}
+		ran, err := migrateUp(migrations)
+		for _, m := range ran {
+			fmt.Fprintf(out, "applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(ran) == 0 {
+			fmt.Fprintln(out, "database is up to date")
+		}
+		return err
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New("usage: migrate down [N], N must be a positive integer")
+			}
+		}
+		reverted, err := migrateDown(migrations, n)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Fprintln(out, "nothing to roll back")
+		}
+		return err
+
+	case "status":
+		return printMigrationStatus(out, migrations)
+
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down [N] or status)", command)
+	}
+}
+
+// applyMigrations 启动时检查版本并执行未执行的迁移
+func applyMigrations() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return err
+	}
+	if err := checkSchemaVersion(migrations); err != nil {
+		return err
+	}
+
+	ran, err := migrateUp(migrations)
+	if err != nil {
+		return err
+	}
+	if len(ran) > 0 {
+		last := ran[len(ran)-1]
+		log.Printf("Applied %d migration(s), schema is now at %04d_%s", len(ran), last.Version, last.Name)
+	}
+	return nil
+}
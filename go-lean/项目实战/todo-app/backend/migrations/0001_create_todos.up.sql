@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS todos (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	desc TEXT,
+	done BOOLEAN DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
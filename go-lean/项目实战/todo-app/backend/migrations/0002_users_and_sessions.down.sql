@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_todos_user_title;
+DROP INDEX IF EXISTS idx_todos_user_created;
+DROP INDEX IF EXISTS idx_todos_user_id;
+
+ALTER TABLE todos DROP COLUMN user_id;
+
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,20 @@
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL
+);
+
+-- 已有的待办事项没有所有者，由第一个注册的用户认领
+ALTER TABLE todos ADD COLUMN user_id INTEGER REFERENCES users(id);
+
+CREATE INDEX idx_todos_user_id ON todos(user_id);
+CREATE INDEX idx_todos_user_created ON todos(user_id, created_at);
+CREATE INDEX idx_todos_user_title ON todos(user_id, title);
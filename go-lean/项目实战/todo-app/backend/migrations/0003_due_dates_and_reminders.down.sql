@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS reminders;
+
+DROP INDEX IF EXISTS idx_todos_user_priority;
+DROP INDEX IF EXISTS idx_todos_user_due;
+
+ALTER TABLE todos DROP COLUMN completed_at;
+ALTER TABLE todos DROP COLUMN due_at;
+ALTER TABLE todos DROP COLUMN priority;
@@ -0,0 +1,19 @@
+-- 优先级：0 low, 1 normal, 2 high, 3 urgent
+ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE todos ADD COLUMN due_at DATETIME;
+ALTER TABLE todos ADD COLUMN completed_at DATETIME;
+
+CREATE INDEX idx_todos_user_due ON todos(user_id, due_at);
+CREATE INDEX idx_todos_user_priority ON todos(user_id, priority, due_at);
+
+-- 提醒记录：同一个待办项的同一个截止时间只提醒一次
+CREATE TABLE reminders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	due_at DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (todo_id, due_at)
+);
+
+CREATE INDEX idx_reminders_user_created ON reminders(user_id, created_at);
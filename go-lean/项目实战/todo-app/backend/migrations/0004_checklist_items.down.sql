@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_checklist_items_todo;
+DROP TABLE IF EXISTS checklist_items;
+
+ALTER TABLE todos DROP COLUMN auto_complete;
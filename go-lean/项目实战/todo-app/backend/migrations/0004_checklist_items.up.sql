@@ -0,0 +1,14 @@
+-- 完成全部检查项后是否自动完成待办项
+ALTER TABLE todos ADD COLUMN auto_complete BOOLEAN NOT NULL DEFAULT 0;
+
+-- 待办项下的检查项（子任务），position 越小越靠前
+CREATE TABLE checklist_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	done BOOLEAN NOT NULL DEFAULT 0,
+	position INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_checklist_items_todo ON checklist_items(todo_id, position);
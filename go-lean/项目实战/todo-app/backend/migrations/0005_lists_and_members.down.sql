@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_todos_list_created;
+
+ALTER TABLE todos DROP COLUMN list_id;
+
+DROP TABLE IF EXISTS list_members;
+DROP TABLE IF EXISTS lists;
@@ -0,0 +1,32 @@
+-- 清单：每个用户有一个不可删除的收件箱（inbox），其余清单可以共享给其他用户
+CREATE TABLE lists (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	inbox BOOLEAN NOT NULL DEFAULT 0,
+	archived BOOLEAN NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_lists_owner_inbox ON lists(owner_id) WHERE inbox = 1;
+
+-- 清单成员及角色：owner 管理清单和成员，editor 修改待办项，viewer 只读
+CREATE TABLE list_members (
+	list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX idx_list_members_user ON list_members(user_id);
+
+ALTER TABLE todos ADD COLUMN list_id INTEGER REFERENCES lists(id);
+
+CREATE INDEX idx_todos_list_created ON todos(list_id, created_at);
+
+-- 已有用户的待办项放入各自的收件箱
+INSERT INTO lists (name, owner_id, inbox) SELECT 'Inbox', id, 1 FROM users;
+INSERT INTO list_members (list_id, user_id, role) SELECT id, owner_id, 'owner' FROM lists;
+UPDATE todos SET list_id = (SELECT id FROM lists WHERE lists.owner_id = todos.user_id AND lists.inbox = 1)
+WHERE user_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_todos_list_position;
+
+ALTER TABLE todos DROP COLUMN position;
@@ -0,0 +1,12 @@
+-- 手动排序位置：可按字典序比较的分数排名（0-9a-z），移动时只需修改一行
+ALTER TABLE todos ADD COLUMN position TEXT NOT NULL DEFAULT '';
+
+-- 已有待办项按原来的默认顺序（最新的在前）编号，以非 0 字符结尾
+UPDATE todos SET position = (
+	SELECT printf('%06di', r.n) FROM (
+		SELECT id, ROW_NUMBER() OVER (PARTITION BY list_id ORDER BY id DESC) AS n FROM todos
+	) AS r
+	WHERE r.id = todos.id
+);
+
+CREATE INDEX idx_todos_list_position ON todos(list_id, position);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS checklist_items_version_delete;
+DROP TRIGGER IF EXISTS checklist_items_version_update;
+DROP TRIGGER IF EXISTS checklist_items_version_insert;
+
+ALTER TABLE todos DROP COLUMN version;
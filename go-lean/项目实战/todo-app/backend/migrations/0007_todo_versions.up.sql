@@ -0,0 +1,18 @@
+-- 乐观并发控制：每次修改待办项时加 1，用于生成 ETag 和检查 If-Match
+ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- 检查项变化会改变待办项返回的进度，同样递增所属待办项的版本号
+CREATE TRIGGER checklist_items_version_insert AFTER INSERT ON checklist_items
+BEGIN
+	UPDATE todos SET version = version + 1 WHERE id = NEW.todo_id;
+END;
+
+CREATE TRIGGER checklist_items_version_update AFTER UPDATE ON checklist_items
+BEGIN
+	UPDATE todos SET version = version + 1 WHERE id = NEW.todo_id;
+END;
+
+CREATE TRIGGER checklist_items_version_delete AFTER DELETE ON checklist_items
+BEGIN
+	UPDATE todos SET version = version + 1 WHERE id = OLD.todo_id;
+END;
@@ -0,0 +1,6 @@
+-- 重复待办项：recurrence 为 RRULE 规则（RFC 5545 的子集），recurrence_tz 为计算下一次截止时间使用的时区
+-- occurrence 是第几次出现，next_occurrence_id 指向完成后生成的下一次待办项，删除下一次时清空
+ALTER TABLE todos ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+ALTER TABLE todos ADD COLUMN recurrence_tz TEXT NOT NULL DEFAULT '';
+ALTER TABLE todos ADD COLUMN occurrence INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE todos ADD COLUMN next_occurrence_id INTEGER REFERENCES todos(id) ON DELETE SET NULL;
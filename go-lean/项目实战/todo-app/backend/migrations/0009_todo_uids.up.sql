@@ -0,0 +1,6 @@
+-- iCalendar 导出导入使用的全局唯一标识，导入时按 uid 更新已有的待办项
+ALTER TABLE todos ADD COLUMN uid TEXT NOT NULL DEFAULT '';
+
+UPDATE todos SET uid = lower(hex(randomblob(16))) || '@todo-app';
+
+CREATE INDEX idx_todos_uid ON todos(uid);
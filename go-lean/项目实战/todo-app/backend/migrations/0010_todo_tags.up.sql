@@ -0,0 +1,3 @@
+-- 标签（JSON 数组，+project 和 @context，与 todo.txt 一致）和扩展字段（JSON 对象，todo.txt 中的其他 key:value）
+ALTER TABLE todos ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE todos ADD COLUMN extensions TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS list_members_joined;
+DROP TRIGGER IF EXISTS todos_changes_delete;
+DROP TRIGGER IF EXISTS todos_changes_update;
+DROP TRIGGER IF EXISTS todos_changes_insert;
+
+ALTER TABLE list_members DROP COLUMN joined_seq;
+
+DROP TABLE IF EXISTS todo_changes;
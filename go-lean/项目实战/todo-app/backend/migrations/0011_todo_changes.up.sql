@@ -0,0 +1,52 @@
+-- 增量同步：新建、修改、删除待办项时由触发器记录变更，seq 单调递增（AUTOINCREMENT 不会复用）
+-- 每个待办项在每个清单中只保留最新的一条；deleted = 1 为墓碑：待办项被删除，或者移到了其他清单
+CREATE TABLE todo_changes (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	todo_id INTEGER NOT NULL,
+	uid TEXT NOT NULL,
+	list_id INTEGER NOT NULL,
+	deleted BOOLEAN NOT NULL DEFAULT 0,
+	changed_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE UNIQUE INDEX idx_todo_changes_todo_list ON todo_changes(todo_id, list_id);
+CREATE INDEX idx_todo_changes_list_seq ON todo_changes(list_id, seq);
+
+-- 已有的待办项各记录一条变更，保证 sqlite_sequence 中有 todo_changes 这一行
+INSERT INTO todo_changes (todo_id, uid, list_id) SELECT id, uid, COALESCE(list_id, 0) FROM todos ORDER BY id;
+INSERT INTO sqlite_sequence (name, seq) SELECT 'todo_changes', 0
+WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'todo_changes');
+
+CREATE TRIGGER todos_changes_insert AFTER INSERT ON todos
+BEGIN
+	DELETE FROM todo_changes WHERE todo_id = NEW.id AND list_id = COALESCE(NEW.list_id, 0);
+	INSERT INTO todo_changes (todo_id, uid, list_id) VALUES (NEW.id, NEW.uid, COALESCE(NEW.list_id, 0));
+END;
+
+CREATE TRIGGER todos_changes_update AFTER UPDATE ON todos
+BEGIN
+	-- 移到其他清单时在原来的清单中留下墓碑
+	DELETE FROM todo_changes WHERE todo_id = OLD.id AND list_id = COALESCE(OLD.list_id, 0)
+	AND COALESCE(OLD.list_id, 0) != COALESCE(NEW.list_id, 0);
+	INSERT INTO todo_changes (todo_id, uid, list_id, deleted) SELECT OLD.id, OLD.uid, COALESCE(OLD.list_id, 0), 1
+	WHERE COALESCE(OLD.list_id, 0) != COALESCE(NEW.list_id, 0);
+
+	DELETE FROM todo_changes WHERE todo_id = NEW.id AND list_id = COALESCE(NEW.list_id, 0);
+	INSERT INTO todo_changes (todo_id, uid, list_id) VALUES (NEW.id, NEW.uid, COALESCE(NEW.list_id, 0));
+END;
+
+CREATE TRIGGER todos_changes_delete AFTER DELETE ON todos
+BEGIN
+	DELETE FROM todo_changes WHERE todo_id = OLD.id AND list_id = COALESCE(OLD.list_id, 0);
+	INSERT INTO todo_changes (todo_id, uid, list_id, deleted) VALUES (OLD.id, OLD.uid, COALESCE(OLD.list_id, 0), 1);
+END;
+
+-- 加入清单时推进序号并记在成员上：同步时把加入之后才能看到的清单中的待办项整个发给客户端
+ALTER TABLE list_members ADD COLUMN joined_seq INTEGER NOT NULL DEFAULT 0;
+
+CREATE TRIGGER list_members_joined AFTER INSERT ON list_members
+BEGIN
+	UPDATE sqlite_sequence SET seq = seq + 1 WHERE name = 'todo_changes';
+	UPDATE list_members SET joined_seq = (SELECT seq FROM sqlite_sequence WHERE name = 'todo_changes')
+	WHERE list_id = NEW.list_id AND user_id = NEW.user_id;
+END;
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ===== 手动排序 =====
+//
+// 待办项的 position 是只包含 0-9a-z 的字符串，按字典序比较。
+// 在两个相邻项之间插入时取两者的"中间值"，因此移动只需修改被移动的一行。
+// 位置不以 0 结尾，保证任意两个不同的位置之间总能找到新的位置。
+// 插到最前或最后时按固定步长减小或增大位置（positionBefore / positionAfter），不会很快变长；
+// 反复在两个相邻项之间插入会让位置变长，移动后超过 maxPositionLength 时重新均匀编号整个清单。
+// 重新编号不改变相对顺序，不增加 version（不影响客户端的 If-Match），但会为每一项发布 updated 事件。
+
+const positionDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const maxPositionLength = 12
+
+var errPositionConflict = errors.New("neighbors are not in order")
+
+// neighborError 请求中的邻居无效，返回 400
+type neighborError string
+
+func (e neighborError) Error() string { return string(e) }
+
+type moveInput struct {
+	After  *int `json:"after"`  // 移到这个待办项之后
+	Before *int `json:"before"` // 移到这个待办项之前
+}
+
+// positionBetween 返回严格位于 lo 和 hi 之间的位置，lo 为空表示最前，hi 为空表示最后
+// 调用方保证 lo < hi（hi 非空时）
+func positionBetween(lo, hi string) string {
+	var out []byte
+	hiBound := hi != ""
+	for i := 0; ; i++ {
+		l := 0
+		if i < len(lo) {
+			l = strings.IndexByte(positionDigits, lo[i])
+		}
+		h := len(positionDigits)
+		if hiBound {
+			h = strings.IndexByte(positionDigits, hi[i])
+		}
+
+		if h-l >= 2 {
+			return string(append(out, positionDigits[(l+h)/2]))
+		}
+
+		// 这一位放不下中间值：沿用 lo 的这一位，继续比较下一位
+		out = append(out, positionDigits[l])
+		if l < h {
+			hiBound = false
+		}
+	}
+}
+
+// positionBefore 返回排在 first 之前的位置，first 为空表示清单为空
+// 把 first 从第一个非 0 数位开始的两位看作一个数减一：连续插到最前约 1260 次位置才变长一位
+func positionBefore(first string) string {
+	if first == "" {
+		return positionBetween("", "")
+	}
+	k := 0
+	for k < len(first)-1 && first[k] == '0' {
+		k++
+	}
+	n := positionWindow(first, k) - 1
+	return strings.TrimSuffix(first[:k]+encodeWindow(n), "0")
+}
+
+// positionAfter 返回排在 last 之后的位置，last 为空表示清单为空
+// 与 positionBefore 对称：把 last 从第一个非 z 数位开始的两位看作一个数加一
+func positionAfter(last string) string {
+	if last == "" {
+		return positionBetween("", "")
+	}
+	k := 0
+	for k < len(last)-1 && last[k] == 'z' {
+		k++
+	}
+	n := positionWindow(last, k) + 1
+	return strings.TrimSuffix(last[:k]+encodeWindow(n), "0")
+}
+
+// positionWindow 把 position 从下标 k 开始的两位（不足两位时补 0）看作一个 36 进制数
+func positionWindow(position string, k int) int {
+	n := 0
+	for i := k; i < k+2; i++ {
+		n *= len(positionDigits)
+		if i < len(position) {
+			n += strings.IndexByte(positionDigits, position[i])
+		}
+	}
+	return n
+}
+
+// encodeWindow 把 0 <= n < 36*36 写成两位（positionAfter 中 last[k] 为 z 时 k 是最后一位，不会超过 "z1"）
+func encodeWindow(n int) string {
+	base := len(positionDigits)
+	return string([]byte{positionDigits[n/base], positionDigits[n%base]})
+}
+
+// spacedPositions 生成 n 个等长、均匀分布、不以 0 结尾的位置
+func spacedPositions(n int) []string {
+	width, capacity := 1, len(positionDigits)
+	for capacity < 2*(n+1) {
+		width++
+		capacity *= len(positionDigits)
+	}
+	step := capacity / (n + 1)
+
+	positions := make([]string, n)
+	for i := range positions {
+		v := (i + 1) * step
+		if v%len(positionDigits) == 0 {
+			v++
+		}
+		buf := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			buf[j] = positionDigits[v%len(positionDigits)]
+			v /= len(positionDigits)
+		}
+		positions[i] = string(buf)
+	}
+	return positions
+}
+
+// rebalanceList 按当前顺序重新均匀编号清单中的待办项，返回重新编号的待办项，
+// 调用方在事务提交后为它们发布 updated 事件
+func rebalanceList(q dbtx, listID int) ([]int, error) {
+	rows, err := q.Query("SELECT id FROM todos WHERE list_id = ? ORDER BY position, id", listID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 相对顺序不变，不增加 version
+	for i, position := range spacedPositions(len(ids)) {
+		if _, err := q.Exec("UPDATE todos SET position = ? WHERE id = ?", position, ids[i]); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Rebalanced positions of %d todo(s) in list %d", len(ids), listID)
+	return ids, nil
+}
+
+// topPosition 返回清单最前面的新位置，新建或移入清单的待办项放在最前
+func topPosition(listID int) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	position, err := topPositionTx(tx, listID)
+	if err != nil {
+		return "", err
+	}
+	return position, tx.Commit()
+}
+
+// topPositionTx 在事务中计算清单最前面的新位置
+// positionBefore 按固定步长减小位置，插到最前不会让位置很快变长，因此这里不需要重新编号
+func topPositionTx(tx *sql.Tx, listID int) (string, error) {
+	var first sql.NullString
+	err := tx.QueryRow("SELECT MIN(position) FROM todos WHERE list_id = ?", listID).Scan(&first)
+	if err != nil {
+		return "", err
+	}
+	return positionBefore(first.String), nil
+}
+
+// movedPosition 待办项移到其他清单时返回新清单最前面的位置，未移动时返回 nil（保持原位置）
+func movedPosition(w http.ResponseWriter, from, to int) (interface{}, bool) {
+	if from == to {
+		return nil, true
+	}
+	position, err := topPosition(to)
+	if err != nil {
+		log.Println("Error computing position:", err)
+		sendError(w, 500, "Failed to update todo")
+		return nil, false
+	}
+	return position, true
+}
+
+// neighborPosition 查询同一清单中相邻待办项的位置
+func neighborPosition(q dbtx, listID, todoID, neighborID int) (string, error) {
+	if neighborID == todoID {
+		return "", neighborError("a todo cannot be moved relative to itself")
+	}
+	var position string
+	err := q.QueryRow("SELECT position FROM todos WHERE id = ? AND list_id = ?", neighborID, listID).Scan(&position)
+	if err == sql.ErrNoRows {
+		return "", neighborError("todo " + strconv.Itoa(neighborID) + " is not in the same list")
+	}
+	return position, err
+}
+
+// adjacentPosition 返回 (position, id) 之后（next）或之前的一项的位置，不存在时返回空
+func adjacentPosition(q dbtx, listID, todoID int, position string, neighborID int, next bool) (string, error) {
+	op, dir := ">", "ASC"
+	if !next {
+		op, dir = "<", "DESC"
+	}
+
+	var adjacent string
+	err := q.QueryRow(
+		"SELECT position FROM todos WHERE list_id = ? AND id != ? AND (position, id) "+op+" (?, ?) ORDER BY position "+dir+", id "+dir+" LIMIT 1",
+		listID, todoID, position, neighborID,
+	).Scan(&adjacent)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return adjacent, err
+}
+
+// movePosition 根据 after / before 计算待办项的新位置
+// 只给出一个邻居时，另一个邻居取它旁边的待办项
+func movePosition(q dbtx, listID, todoID int, input moveInput) (string, error) {
+	var lo, hi string
+	var err error
+
+	if input.After != nil {
+		if lo, err = neighborPosition(q, listID, todoID, *input.After); err != nil {
+			return "", err
+		}
+	}
+	if input.Before != nil {
+		if hi, err = neighborPosition(q, listID, todoID, *input.Before); err != nil {
+			return "", err
+		}
+	}
+
+	if input.After != nil && input.Before == nil {
+		hi, err = adjacentPosition(q, listID, todoID, lo, *input.After, true)
+	} else if input.Before != nil && input.After == nil {
+		lo, err = adjacentPosition(q, listID, todoID, hi, *input.Before, false)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// 移到最前或最后时按固定步长，移到两项之间时取中间值
+	switch {
+	case lo == "":
+		return positionBefore(hi), nil
+	case hi == "":
+		return positionAfter(lo), nil
+	case lo >= hi:
+		return "", errPositionConflict
+	}
+	return positionBetween(lo, hi), nil
+}
+
+// POST /api/todos/{id}/move - 移动待办项到 after 之后和/或 before 之前
+func moveTodo(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		sendError(w, 400, "Invalid ID format")
+		return
+	}
+
+	var input moveInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	if input.After == nil && input.Before == nil {
+		sendError(w, 400, "after or before is required")
+		return
+	}
+
+	listID, ok := authorizeTodo(w, r, id, RoleEditor)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to move todo")
+		return
+	}
+	defer tx.Rollback()
+
+	// 重新编号过的待办项在提交后发布 updated 事件
+	var rebalanced []int
+	position, err := movePosition(tx, listID, id, input)
+	if err == errPositionConflict {
+		// 位置相同（例如刚从其他清单移入）时先重新编号再计算
+		if rebalanced, err = rebalanceList(tx, listID); err == nil {
+			position, err = movePosition(tx, listID, id, input)
+		}
+		if err == errPositionConflict {
+			sendError(w, 400, "after must come before before")
+			return
+		}
+	}
+	var invalid neighborError
+	if errors.As(err, &invalid) {
+		sendError(w, 400, invalid.Error())
+		return
+	}
+	if err != nil {
+		log.Println("Error computing position:", err)
+		sendError(w, 500, "Failed to move todo")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE todos SET position = ?, version = version + 1 WHERE id = ?", position, id); err != nil {
+		log.Println("Error moving todo:", err)
+		sendError(w, 500, "Failed to move todo")
+		return
+	}
+
+	if len(position) > maxPositionLength {
+		if rebalanced, err = rebalanceList(tx, listID); err != nil {
+			log.Println("Error rebalancing list:", err)
+			sendError(w, 500, "Failed to move todo")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		sendError(w, 500, "Failed to move todo")
+		return
+	}
+	events := []todoEvent{newTodoEvent("updated", id)}
+	for _, other := range rebalanced {
+		if other != id {
+			events = append(events, newTodoEvent("updated", other))
+		}
+	}
+	publishTodoEvents(events...)
+
+	todo, err := findTodo(id, currentUserID(r))
+	if err != nil {
+		log.Println("Error reloading todo:", err)
+		sendError(w, 500, "Failed to retrieve todo")
+		return
+	}
+
+	sendJSON(w, 0, "Todo moved", todo)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkPosition 检查位置只包含合法字符、不以 0 结尾，并且严格位于 lo 和 hi 之间
+func checkPosition(t *testing.T, pos, lo, hi string) {
+	t.Helper()
+	if pos == "" || strings.Trim(pos, positionDigits) != "" {
+		t.Fatalf("positionBetween(%q, %q) = %q, not a valid position", lo, hi, pos)
+	}
+	if strings.HasSuffix(pos, "0") {
+		t.Fatalf("positionBetween(%q, %q) = %q, ends with 0", lo, hi, pos)
+	}
+	if pos <= lo || (hi != "" && pos >= hi) {
+		t.Fatalf("positionBetween(%q, %q) = %q, not strictly between", lo, hi, pos)
+	}
+}
+
+func TestPositionBetween(t *testing.T) {
+	tests := []struct {
+		lo, hi string
+		want   string
+	}{
+		{"", "", "i"},
+		{"", "i", "9"},
+		{"i", "", "r"},
+		{"1", "2", "1i"},
+		{"a", "a1", "a0i"},
+		{"az", "b", "azi"},
+		{"z", "", "zi"},
+		{"", "01", "00i"},
+		{"a", "c", "b"},
+	}
+
+	for _, tt := range tests {
+		got := positionBetween(tt.lo, tt.hi)
+		checkPosition(t, got, tt.lo, tt.hi)
+		if got != tt.want {
+			t.Errorf("positionBetween(%q, %q) = %q, want %q", tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
+
+func TestPositionBetweenRepeatedInserts(t *testing.T) {
+	// 反复插到最前、最后和同一对邻居之间，位置始终保持有序
+	first, last := "i", "i"
+	lo, hi := "a", "b"
+	for i := 0; i < 200; i++ {
+		pos := positionBetween("", first)
+		checkPosition(t, pos, "", first)
+		first = pos
+
+		pos = positionBetween(last, "")
+		checkPosition(t, pos, last, "")
+		last = pos
+
+		pos = positionBetween(lo, hi)
+		checkPosition(t, pos, lo, hi)
+		if i%2 == 0 {
+			lo = pos
+		} else {
+			hi = pos
+		}
+	}
+}
+
+func TestSpacedPositions(t *testing.T) {
+	for _, n := range []int{1, 2, 17, 35, 36, 1000} {
+		positions := spacedPositions(n)
+		if len(positions) != n {
+			t.Fatalf("spacedPositions(%d) returned %d positions", n, len(positions))
+		}
+		for i, pos := range positions {
+			if len(pos) != len(positions[0]) {
+				t.Fatalf("spacedPositions(%d): %q and %q have different lengths", n, positions[0], pos)
+			}
+			if strings.HasSuffix(pos, "0") {
+				t.Fatalf("spacedPositions(%d): %q ends with 0", n, pos)
+			}
+			if i > 0 && pos <= positions[i-1] {
+				t.Fatalf("spacedPositions(%d): %q is not after %q", n, pos, positions[i-1])
+			}
+		}
+	}
+}
+
+func TestPositionBeforeAndAfter(t *testing.T) {
+	tests := []struct {
+		fn       func(string) string
+		name     string
+		in, want string
+	}{
+		{positionBefore, "before", "", "i"},
+		{positionBefore, "before", "i", "hz"},
+		{positionBefore, "before", "hz", "hy"},
+		{positionBefore, "before", "h1", "h"},
+		{positionBefore, "before", "1", "0z"},
+		{positionBefore, "before", "01", "00z"},
+		{positionBefore, "before", "0c5", "0c4"},
+		{positionAfter, "after", "", "i"},
+		{positionAfter, "after", "i", "i1"},
+		{positionAfter, "after", "hz", "i"},
+		{positionAfter, "after", "zy5", "zy6"},
+		{positionAfter, "after", "zz", "zz1"},
+		{positionAfter, "after", "zzz", "zzz1"},
+	}
+
+	for _, tt := range tests {
+		got := tt.fn(tt.in)
+		if got != tt.want {
+			t.Errorf("position%s(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRepeatedTopAndBottomInsertsStayShort(t *testing.T) {
+	// 新建的待办项总是插到最前：位置约 1260 次才变长一位，几千次之后仍然很短，不需要重新编号
+	first, last := "i", "i"
+	for i := 0; i < 5000; i++ {
+		pos := positionBefore(first)
+		checkPosition(t, pos, "", first)
+		first = pos
+
+		pos = positionAfter(last)
+		checkPosition(t, pos, last, "")
+		last = pos
+	}
+	if len(first) > 6 {
+		t.Errorf("after 5000 top inserts the first position is %q", first)
+	}
+	if len(last) > 6 {
+		t.Errorf("after 5000 bottom inserts the last position is %q", last)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== 列表查询参数 =====
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// 没有截止时间的待办项排在最后
+const noDueDate = "9999-12-31 23:59:59"
+
+// sortKey 排序键：SQL 表达式，以及从记录中取出同一个值用于生成游标
+type sortKey struct {
+	expr  string
+	value func(Todo) interface{}
+}
+
+var dueKey = sortKey{
+	expr: "COALESCE(due_at, '" + noDueDate + "')",
+	value: func(t Todo) interface{} {
+		if t.DueAt == nil {
+			return noDueDate
+		}
+		return formatTime(*t.DueAt)
+	},
+}
+
+// 允许排序的字段及其排序键（id 总是作为最后一个排序键）
+// priority 按优先级从高到低、再按截止时间从早到晚排序
+var sortKeys = map[string][]sortKey{
+	"position":   {{"position", func(t Todo) interface{} { return t.Position }}},
+	"id":         nil,
+	"created_at": {{"created_at", func(t Todo) interface{} { return formatTime(t.CreatedAt) }}},
+	"title":      {{"title", func(t Todo) interface{} { return t.Title }}},
+	"due_at":     {dueKey},
+	"priority": {
+		{"-priority", func(t Todo) interface{} { level, _ := priorityLevel(t.Priority); return -level }},
+		dueKey,
+	},
+}
+
+// 未指定 order 时的默认方向：手动顺序、截止时间和优先级默认正序
+var sortDefaultDesc = map[string]bool{
+	"position":   false,
+	"id":         true,
+	"created_at": true,
+	"title":      true,
+	"due_at":     false,
+	"priority":   false,
+}
+
+type listQuery struct {
+	ListID   int
+	Done     *bool
+	Q        string
+	DueWhere string
+	DueArgs  []interface{}
+	Sort     string
+	Desc     bool
+	Limit    int
+	Cursor   *pageCursor
+}
+
+// pageCursor 不透明的翻页游标，记录上一页最后一条记录的排序键
+type pageCursor struct {
+	Sort   string        `json:"s"`
+	Desc   bool          `json:"d"`
+	Values []interface{} `json:"v,omitempty"`
+	ID     int           `json:"id"`
+}
+
+// parseListQuery 解析 GET /api/todos 的查询参数
+// done=true|false, q=关键字, due=overdue|today, tz=时区,
+// sort=position|id|created_at|title|due_at|priority, order=asc|desc, limit=N, cursor=...
+func parseListQuery(r *http.Request) (listQuery, error) {
+	params := r.URL.Query()
+	query := listQuery{
+		Sort:  "position",
+		Limit: defaultPageSize,
+		Q:     strings.TrimSpace(params.Get("q")),
+	}
+
+	if v := params.Get("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, errors.New("done must be true or false")
+		}
+		query.Done = &done
+	}
+
+	if v := params.Get("due"); v != "" {
+		where, args, err := dueRange(r, v, time.Now())
+		if err != nil {
+			return query, err
+		}
+		query.DueWhere, query.DueArgs = where, args
+	}
+
+	if v := params.Get("sort"); v != "" {
+		if _, ok := sortKeys[v]; !ok {
+			return query, errors.New("sort must be one of position, id, created_at, title, due_at, priority")
+		}
+		query.Sort = v
+	}
+
+	switch strings.ToLower(params.Get("order")) {
+	case "":
+		query.Desc = sortDefaultDesc[query.Sort]
+	case "desc":
+		query.Desc = true
+	case "asc":
+		query.Desc = false
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return query, errors.New("limit must be a positive integer")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		query.Limit = limit
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return query, errors.New("invalid cursor")
+		}
+		if cursor.Sort != query.Sort || cursor.Desc != query.Desc || len(cursor.Values) != len(sortKeys[query.Sort]) {
+			return query, errors.New("cursor does not match sort order")
+		}
+		query.Cursor = &cursor
+	}
+
+	return query, nil
+}
+
+// buildListSQL 根据查询参数生成 WHERE / ORDER BY 子句，使用键集分页
+func buildListSQL(userID int, query listQuery) (string, []interface{}) {
+	// 指定清单时只查该清单（调用方已检查成员身份），否则查用户所在的全部未归档清单
+	conditions := []string{"list_id IN (" + activeLists + ")"}
+	args := []interface{}{userID}
+	if query.ListID != 0 {
+		conditions = []string{"list_id = ?"}
+		args = []interface{}{query.ListID}
+	}
+
+	if query.Done != nil {
+		conditions = append(conditions, "done = ?")
+		args = append(args, *query.Done)
+	}
+
+	if query.Q != "" {
+		pattern := "%" + escapeLike(query.Q) + "%"
+		conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR desc LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	if query.DueWhere != "" {
+		conditions = append(conditions, query.DueWhere)
+		args = append(args, query.DueArgs...)
+	}
+
+	op, dir := ">", "ASC"
+	if query.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	var exprs, order []string
+	for _, key := range sortKeys[query.Sort] {
+		exprs = append(exprs, key.expr)
+		order = append(order, key.expr+" "+dir)
+	}
+	exprs = append(exprs, "id")
+	order = append(order, "id "+dir)
+
+	// 键集分页：用行值比较 (k1, k2, id) > (?, ?, ?) 跳过已返回的记录
+	if c := query.Cursor; c != nil {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(exprs)), ", ")
+		conditions = append(conditions, "("+strings.Join(exprs, ", ")+") "+op+" ("+placeholders+")")
+		args = append(args, c.Values...)
+		args = append(args, c.ID)
+	}
+
+	clause := " WHERE " + strings.Join(conditions, " AND ") + " ORDER BY " + strings.Join(order, ", ")
+
+	// 多取一条用来判断是否还有下一页
+	clause += " LIMIT ?"
+	args = append(args, query.Limit+1)
+
+	return clause, args
+}
+
+// nextCursor 根据本页最后一条记录生成下一页游标
+func nextCursor(query listQuery, last Todo) string {
+	cursor := pageCursor{Sort: query.Sort, Desc: query.Desc, ID: last.ID}
+	for _, key := range sortKeys[query.Sort] {
+		cursor.Values = append(cursor.Values, key.value(last))
+	}
+	return encodeCursor(cursor)
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解析游标并检查排序键的类型
+func decodeCursor(s string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+	// 排序键只会是字符串或数字，其他类型（对象、数组、null）说明游标被篡改
+	for _, value := range cursor.Values {
+		switch value.(type) {
+		case string, float64:
+		default:
+			return cursor, errors.New("cursor values must be strings or numbers")
+		}
+	}
+	return cursor, nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== 重复规则 =====
+//
+// recurrence 支持 RFC 5545 RRULE 的一个子集，例如：
+//   FREQ=DAILY;INTERVAL=2                 每两天
+//   FREQ=WEEKLY;BYDAY=MO,TH               每周一和周四
+//   FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=6  每月第一天和最后一天，共 6 次
+//   FREQ=MONTHLY;INTERVAL=3;UNTIL=20271231 每三个月一次，到 2027-12-31 为止
+// 下一次的截止时间在 recurrence_tz 时区中按日历计算，保持原来截止时间的钟点（跨夏令时也不变）。
+
+// 支持的重复频率
+const (
+	freqDaily   = "DAILY"
+	freqWeekly  = "WEEKLY"
+	freqMonthly = "MONTHLY"
+)
+
+// INTERVAL 的上限
+const maxRecurrenceInterval = 1000
+
+// MONTHLY 规则查找下一个存在的日期时最多检查的周期数（如 BYMONTHDAY=31 跳过小月，2 月 29 日等闰年）
+const maxMonthlyPeriods = 400
+
+// RRULE 中的星期缩写，下标与 time.Weekday 一致
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// recurrenceRule 解析后的重复规则
+type recurrenceRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday // 按周一到周日排序
+	ByMonthDay []int          // 负数表示倒数第几天
+	Until      string         // 原样保留的 UNTIL：YYYYMMDD 或 YYYYMMDDTHHMMSSZ
+	Count      int
+}
+
+// parseRecurrence 解析 RRULE 字符串，可以带 "RRULE:" 前缀，规则名不区分大小写
+func parseRecurrence(value string) (recurrenceRule, error) {
+	rule := recurrenceRule{Interval: 1}
+	value = strings.TrimSpace(value)
+	if len(value) >= 6 && strings.EqualFold(value[:6], "RRULE:") {
+		value = value[6:]
+	}
+
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		name, arg, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		arg = strings.ToUpper(strings.TrimSpace(arg))
+		if !ok || arg == "" {
+			return rule, fmt.Errorf("invalid recurrence part %q", part)
+		}
+		if seen[name] {
+			return rule, fmt.Errorf("duplicate recurrence part %s", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			if arg != freqDaily && arg != freqWeekly && arg != freqMonthly {
+				return rule, errors.New("FREQ must be one of DAILY, WEEKLY, MONTHLY")
+			}
+			rule.Freq = arg
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(arg)
+			if err != nil || rule.Interval < 1 || rule.Interval > maxRecurrenceInterval {
+				return rule, fmt.Errorf("INTERVAL must be between 1 and %d", maxRecurrenceInterval)
+			}
+		case "BYDAY":
+			if rule.ByDay, err = parseByDay(arg); err != nil {
+				return rule, err
+			}
+		case "BYMONTHDAY":
+			if rule.ByMonthDay, err = parseByMonthDay(arg); err != nil {
+				return rule, err
+			}
+		case "UNTIL":
+			if _, err := parseUntil(arg, time.UTC); err != nil {
+				return rule, err
+			}
+			rule.Until = arg
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(arg)
+			if err != nil || rule.Count < 1 {
+				return rule, errors.New("COUNT must be a positive integer")
+			}
+		default:
+			return rule, fmt.Errorf("unsupported recurrence part %s", name)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return rule, errors.New("recurrence needs a FREQ")
+	case rule.ByDay != nil && rule.Freq == freqMonthly:
+		return rule, errors.New("BYDAY is only supported with FREQ=DAILY or WEEKLY")
+	case rule.ByMonthDay != nil && rule.Freq != freqMonthly:
+		return rule, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	case rule.Until != "" && rule.Count != 0:
+		return rule, errors.New("UNTIL and COUNT cannot be used together")
+	}
+	return rule, nil
+}
+
+// parseByDay 解析 BYDAY=MO,WE,FR，不支持 1MO 这样带序号的写法
+func parseByDay(arg string) ([]time.Weekday, error) {
+	set := map[time.Weekday]bool{}
+	for _, code := range strings.Split(arg, ",") {
+		found := false
+		for day, c := range weekdayCodes {
+			if c == code {
+				set[time.Weekday(day)] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid BYDAY value %q", code)
+		}
+	}
+
+	days := make([]time.Weekday, 0, len(set))
+	for day := range set {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return mondayIndex(days[i]) < mondayIndex(days[j]) })
+	return days, nil
+}
+
+// parseByMonthDay 解析 BYMONTHDAY=1,15,-1，取值为 1..31 或 -31..-1
+func parseByMonthDay(arg string) ([]int, error) {
+	set := map[int]bool{}
+	for _, s := range strings.Split(arg, ",") {
+		day, err := strconv.Atoi(s)
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, fmt.Errorf("invalid BYMONTHDAY value %q", s)
+		}
+		set[day] = true
+	}
+
+	days := make([]int, 0, len(set))
+	for day := range set {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	return days, nil
+}
+
+// parseUntil 解析 UNTIL：YYYYMMDDTHHMMSSZ 为 UTC 时刻，YYYYMMDD 为 loc 中当天结束（包含这一天）
+func parseUntil(arg string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", arg); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("20060102", arg, loc)
+	if err != nil {
+		return time.Time{}, errors.New("UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ")
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// String 返回规范形式的规则，各部分顺序固定，INTERVAL=1 省略
+func (rule recurrenceRule) String() string {
+	parts := []string{"FREQ=" + rule.Freq}
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if len(rule.ByDay) > 0 {
+		codes := make([]string, len(rule.ByDay))
+		for i, day := range rule.ByDay {
+			codes[i] = weekdayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(rule.ByMonthDay) > 0 {
+		days := make([]string, len(rule.ByMonthDay))
+		for i, day := range rule.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if rule.Until != "" {
+		parts = append(parts, "UNTIL="+rule.Until)
+	}
+	if rule.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// next 计算 due 之后的下一次截止时间；occurrence 为 due 是第几次，
+// 达到 COUNT、超过 UNTIL 或找不到符合规则的日期时返回 false
+func (rule recurrenceRule) next(due time.Time, loc *time.Location, occurrence int) (time.Time, bool) {
+	if rule.Count > 0 && occurrence >= rule.Count {
+		return time.Time{}, false
+	}
+
+	local := due.In(loc)
+	var day time.Time
+	var ok bool
+	if rule.Freq == freqMonthly {
+		day, ok = rule.nextMonthDay(local)
+	} else {
+		day, ok = rule.nextWeekDay(local)
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+
+	next := time.Date(day.Year(), day.Month(), day.Day(), local.Hour(), local.Minute(), local.Second(), 0, loc)
+	if rule.Until != "" {
+		until, err := parseUntil(rule.Until, loc)
+		if err != nil || next.After(until) {
+			return time.Time{}, false
+		}
+	}
+	return next.UTC(), true
+}
+
+// nextWeekDay 逐天查找 DAILY / WEEKLY 规则的下一个日期
+func (rule recurrenceRule) nextWeekDay(start time.Time) (time.Time, bool) {
+	startDay := dayNumber(start)
+	for offset := 1; offset <= 7*(rule.Interval+1); offset++ {
+		day := start.AddDate(0, 0, offset)
+		if rule.Freq == freqDaily {
+			if offset%rule.Interval == 0 && rule.matchesWeekday(day) {
+				return day, true
+			}
+			continue
+		}
+		// WEEKLY：周从周一开始，与起始日期相隔的周数必须是 INTERVAL 的倍数；未指定 BYDAY 时为起始日期的星期
+		weeks := (dayNumber(day) - mondayIndex(day.Weekday()) - (startDay - mondayIndex(start.Weekday()))) / 7
+		if weeks%rule.Interval != 0 {
+			continue
+		}
+		if rule.ByDay == nil && day.Weekday() != start.Weekday() {
+			continue
+		}
+		if rule.matchesWeekday(day) {
+			return day, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nextMonthDay 按月查找 MONTHLY 规则的下一个日期，当月不存在的日期（如 31 日）直接跳过
+func (rule recurrenceRule) nextMonthDay(start time.Time) (time.Time, bool) {
+	days := rule.ByMonthDay
+	if days == nil {
+		days = []int{start.Day()}
+	}
+
+	for period := 0; period <= maxMonthlyPeriods; period++ {
+		first := time.Date(start.Year(), start.Month()+time.Month(period*rule.Interval), 1, 0, 0, 0, 0, time.UTC)
+		length := first.AddDate(0, 1, -1).Day()
+
+		var candidates []int
+		for _, d := range days {
+			if d < 0 {
+				d = length + d + 1
+			}
+			if d >= 1 && d <= length {
+				candidates = append(candidates, d)
+			}
+		}
+		sort.Ints(candidates)
+
+		for _, d := range candidates {
+			day := first.AddDate(0, 0, d-1)
+			if dayNumber(day) > dayNumber(start) {
+				return day, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// matchesWeekday 未指定 BYDAY 时任何一天都符合
+func (rule recurrenceRule) matchesWeekday(day time.Time) bool {
+	if rule.ByDay == nil {
+		return true
+	}
+	for _, weekday := range rule.ByDay {
+		if weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// dayNumber 把日期（忽略时区和钟点）换算成连续的天数，用于计算相隔的天数
+func dayNumber(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// mondayIndex 以周一为 0 的星期序号
+func mondayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// ===== 验证和生成下一次 =====
+
+// normalizeRecurrence 验证待办项的重复规则和时区，并改写成规范形式
+// 没有重复规则时清空时区；有重复规则时必须有截止时间，时区默认为 UTC
+func normalizeRecurrence(todo *Todo) error {
+	if strings.TrimSpace(todo.Recurrence) == "" {
+		todo.Recurrence, todo.RecurrenceTZ = "", ""
+		return nil
+	}
+
+	rule, err := parseRecurrence(todo.Recurrence)
+	if err != nil {
+		return err
+	}
+	if todo.DueAt == nil {
+		return errors.New("Recurring todos need a due_at")
+	}
+	if todo.RecurrenceTZ == "" {
+		todo.RecurrenceTZ = "UTC"
+	}
+	if _, err := time.LoadLocation(todo.RecurrenceTZ); err != nil {
+		return errors.New("invalid recurrence_tz")
+	}
+	todo.Recurrence = rule.String()
+	return nil
+}
+
+// spawnNextOccurrence 已完成的重复待办项生成下一次：复制标题、描述、优先级、规则、标签和检查项（全部未完成），
+// 放在清单最前面，并记录到 next_occurrence_id，因此重复切换完成状态不会生成多次。
+// 返回新待办项的 ID，不需要生成（未完成、没有规则、规则已结束）时返回 0
+func spawnNextOccurrence(tx *sql.Tx, id int) (int, error) {
+	var listID, occurrence int
+	var done bool
+	var recurrence, tz string
+	var dueAt sql.NullTime
+	var next sql.NullInt64
+	err := tx.QueryRow(
+		"SELECT COALESCE(list_id, 0), done, recurrence, recurrence_tz, occurrence, due_at, next_occurrence_id FROM todos WHERE id = ?",
+		id,
+	).Scan(&listID, &done, &recurrence, &tz, &occurrence, &dueAt, &next)
+	if err != nil {
+		return 0, err
+	}
+	if !done || recurrence == "" || !dueAt.Valid || next.Valid {
+		return 0, nil
+	}
+
+	rule, err := parseRecurrence(recurrence)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return 0, err
+	}
+	nextDue, ok := rule.next(dueAt.Time, loc, occurrence)
+	if !ok {
+		return 0, nil
+	}
+
+	position, err := topPositionTx(tx, listID)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := newTodoUID()
+	if err != nil {
+		return 0, err
+	}
+	now := formatTime(time.Now())
+	result, err := tx.Exec(`
+		INSERT INTO todos (uid, list_id, position, title, desc, done, priority, due_at, auto_complete, user_id, recurrence, recurrence_tz, occurrence, tags, extensions, created_at)
+		SELECT ?, list_id, ?, title, desc, 0, priority, ?, auto_complete, user_id, recurrence, recurrence_tz, occurrence + 1, tags, extensions, ?
+		FROM todos WHERE id = ?`,
+		uid, position, formatTime(nextDue), now, id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	nextID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO checklist_items (todo_id, title, done, position, created_at) SELECT ?, title, 0, position, ? FROM checklist_items WHERE todo_id = ? ORDER BY position",
+		nextID, now, id,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE todos SET next_occurrence_id = ?, version = version + 1 WHERE id = ?", nextID, id)
+	return int(nextID), err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试不依赖系统时区数据库
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       string
+		tz         string
+		due        string // RFC 3339，UTC
+		occurrence int
+		want       string // 空表示没有下一次
+	}{
+		// 夏令时：保持时区中的钟点，UTC 时刻随之变化
+		{"daily across spring forward", "FREQ=DAILY", "America/New_York", "2026-03-07T14:00:00Z", 1, "2026-03-08T13:00:00Z"},
+		{"daily across fall back", "FREQ=DAILY", "America/New_York", "2026-10-31T13:00:00Z", 1, "2026-11-01T14:00:00Z"},
+		{"weekly byday across spring forward", "FREQ=WEEKLY;BYDAY=MO,TH", "America/New_York", "2026-03-05T14:00:00Z", 1, "2026-03-09T13:00:00Z"},
+		{"monthly across dst in berlin", "FREQ=MONTHLY", "Europe/Berlin", "2026-03-15T07:00:00Z", 1, "2026-04-15T06:00:00Z"},
+		{"weekly interval across fall back", "FREQ=WEEKLY;INTERVAL=2", "Europe/Berlin", "2026-10-20T06:00:00Z", 1, "2026-11-03T07:00:00Z"},
+		// 截止时间在 UTC 是前一天，在时区中是当天
+		{"local calendar day", "FREQ=MONTHLY;BYMONTHDAY=-1", "Asia/Shanghai", "2026-01-30T16:00:00Z", 1, "2026-02-27T16:00:00Z"},
+
+		// 月末：BYMONTHDAY=-1 每月最后一天，31 日跳过小月
+		{"last day to february", "FREQ=MONTHLY;BYMONTHDAY=-1", "UTC", "2026-01-31T09:00:00Z", 1, "2026-02-28T09:00:00Z"},
+		{"last day from february", "FREQ=MONTHLY;BYMONTHDAY=-1", "UTC", "2026-02-28T09:00:00Z", 1, "2026-03-31T09:00:00Z"},
+		{"last day in leap year", "FREQ=MONTHLY;BYMONTHDAY=-1", "UTC", "2028-01-31T09:00:00Z", 1, "2028-02-29T09:00:00Z"},
+		{"31st skips february", "FREQ=MONTHLY;BYMONTHDAY=31", "UTC", "2026-01-31T09:00:00Z", 1, "2026-03-31T09:00:00Z"},
+		{"31st skips april", "FREQ=MONTHLY;BYMONTHDAY=31", "UTC", "2026-03-31T09:00:00Z", 1, "2026-05-31T09:00:00Z"},
+		{"30th skips february", "FREQ=MONTHLY;BYMONTHDAY=30", "UTC", "2026-01-30T09:00:00Z", 1, "2026-03-30T09:00:00Z"},
+		{"29th in leap february", "FREQ=MONTHLY;BYMONTHDAY=29", "UTC", "2028-01-29T09:00:00Z", 1, "2028-02-29T09:00:00Z"},
+		{"first and last same month", "FREQ=MONTHLY;BYMONTHDAY=1,-1", "UTC", "2026-04-01T09:00:00Z", 1, "2026-04-30T09:00:00Z"},
+		{"first and last next month", "FREQ=MONTHLY;BYMONTHDAY=1,-1", "UTC", "2026-04-30T09:00:00Z", 1, "2026-05-01T09:00:00Z"},
+		{"day of due skips short month", "FREQ=MONTHLY", "UTC", "2026-01-31T09:00:00Z", 1, "2026-03-31T09:00:00Z"},
+		{"interval skips to next period", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31", "UTC", "2026-01-31T09:00:00Z", 1, "2026-03-31T09:00:00Z"},
+
+		// COUNT / UNTIL
+		{"count reached", "FREQ=DAILY;COUNT=3", "UTC", "2026-01-03T09:00:00Z", 3, ""},
+		{"count not reached", "FREQ=DAILY;COUNT=3", "UTC", "2026-01-02T09:00:00Z", 2, "2026-01-03T09:00:00Z"},
+		{"until includes last day", "FREQ=DAILY;UNTIL=20260310", "America/New_York", "2026-03-09T13:00:00Z", 1, "2026-03-10T13:00:00Z"},
+		{"until passed", "FREQ=DAILY;UNTIL=20260310", "America/New_York", "2026-03-10T13:00:00Z", 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatalf("parseRecurrence(%q): %v", tt.rule, err)
+			}
+			loc, err := time.LoadLocation(tt.tz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			due, err := time.Parse(time.RFC3339, tt.due)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next, ok := rule.next(due, loc, tt.occurrence)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("next(%s) = %s, want no next occurrence", tt.due, next.Format(time.RFC3339))
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("next(%s) found no next occurrence, want %s", tt.due, tt.want)
+			}
+			if got := next.Format(time.RFC3339); got != tt.want {
+				t.Errorf("next(%s) = %s, want %s", tt.due, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // 规范形式，空表示应当报错
+	}{
+		{"RRULE:freq=weekly;byday=th,mo", "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{"FREQ=MONTHLY;INTERVAL=1;BYMONTHDAY=-1,1,1", "FREQ=MONTHLY;BYMONTHDAY=-1,1"},
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20271231", "FREQ=DAILY;INTERVAL=2;UNTIL=20271231"},
+		{"FREQ=YEARLY", ""},
+		{"FREQ=DAILY;BYMONTHDAY=1", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", ""},
+		{"FREQ=MONTHLY;BYDAY=MO", ""},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20271231", ""},
+		{"FREQ=DAILY;FREQ=WEEKLY", ""},
+		{"INTERVAL=2", ""},
+	}
+
+	for _, tt := range tests {
+		rule, err := parseRecurrence(tt.input)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parseRecurrence(%q) = %s, want error", tt.input, rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRecurrence(%q): %v", tt.input, err)
+			continue
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("parseRecurrence(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ===== 增量同步 =====
+//
+// 离线客户端通过 todo_changes 表同步（由迁移 0011 中的触发器维护，任何修改待办项的语句都会记录）：
+// GET /api/sync?since=TOKEN 返回 TOKEN 之后的变更和新的 TOKEN，TOKEN 就是变更序号；
+// POST /api/sync 上传客户端离线时的修改，按 uid 找到待办项，与服务端的修改冲突时按 strategy 解决。
+
+// 一次最多上传的修改数
+const maxSyncChanges = 1000
+
+// syncChange 下发给客户端的一条变更，deleted 为 true 时客户端应删除该待办项（墓碑，没有 todo）
+type syncChange struct {
+	Seq       int64     `json:"seq"`
+	ID        int       `json:"id"`
+	UID       string    `json:"uid"`
+	ListID    int       `json:"list_id"`
+	Deleted   bool      `json:"deleted"`
+	ChangedAt time.Time `json:"changed_at"`
+	Todo      *Todo     `json:"todo,omitempty"`
+}
+
+type syncRequest struct {
+	Strategy string             `json:"strategy"` // lww / merge，默认 merge
+	Changes  []clientTodoChange `json:"changes"`
+}
+
+// clientTodoChange 客户端的一条修改
+// patch 为修改过的字段（与 PATCH 相同的字段），base 为这些字段在 base_version 时的值，用于逐字段合并
+type clientTodoChange struct {
+	UID         string                     `json:"uid"`
+	BaseVersion int                        `json:"base_version"` // 客户端最后看到的版本号，离线新建的待办项为 0
+	ModifiedAt  *time.Time                 `json:"modified_at"`  // 客户端修改的时间，冲突时比较先后
+	Deleted     bool                       `json:"deleted"`
+	Patch       map[string]json.RawMessage `json:"patch"`
+	Base        map[string]json.RawMessage `json:"base"`
+}
+
+// syncConflict 客户端和服务端都修改过的字段，删除冲突时 field 为 deleted
+type syncConflict struct {
+	Field  string      `json:"field"`
+	Client interface{} `json:"client"`
+	Server interface{} `json:"server"`
+	Winner string      `json:"winner"` // client / server
+}
+
+// syncResult 一条修改的处理结果，action 为 created / updated / deleted / unchanged / rejected
+// code 不为 0 时修改无效，与单独调用对应接口时的状态码一致；todo 为处理后服务端的待办项
+type syncResult struct {
+	Index     int            `json:"index"`
+	UID       string         `json:"uid"`
+	ID        int            `json:"id,omitempty"`
+	Action    string         `json:"action,omitempty"`
+	Conflicts []syncConflict `json:"conflicts,omitempty"`
+	Code      int            `json:"code"`
+	Message   string         `json:"message"`
+	Todo      *Todo          `json:"todo,omitempty"`
+}
+
+// currentSyncSeq 返回当前的变更序号（包括加入清单时推进的序号）
+func currentSyncSeq(q dbtx) (int64, error) {
+	var seq int64
+	err := q.QueryRow("SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'todo_changes'), 0)").Scan(&seq)
+	return seq, err
+}
+
+// parseSyncToken 解析 since 参数，为空时返回 0（全量同步）
+func parseSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid sync token")
+	}
+	return seq, nil
+}
+
+// querySyncChanges 查询用户所在清单中 since 之后的变更，按序号排列
+// 在 since 之后才加入的清单，其中的待办项不管什么时候修改的都会返回；全量同步时不返回墓碑
+func querySyncChanges(tx *sql.Tx, userID int, since int64) ([]syncChange, error) {
+	rows, err := tx.Query(`
+		SELECT todo_changes.seq, todo_changes.todo_id, todo_changes.uid, todo_changes.list_id, todo_changes.deleted, todo_changes.changed_at
+		FROM todo_changes
+		JOIN list_members ON list_members.list_id = todo_changes.list_id AND list_members.user_id = ?
+		WHERE (todo_changes.seq > ? OR list_members.joined_seq > ?) AND NOT (todo_changes.deleted AND ? = 0)
+		ORDER BY todo_changes.seq`,
+		userID, since, since, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	changes := []syncChange{}
+	for rows.Next() {
+		var change syncChange
+		if err := rows.Scan(&change.Seq, &change.ID, &change.UID, &change.ListID, &change.Deleted, &change.ChangedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range changes {
+		if changes[i].Deleted {
+			continue
+		}
+		todo, err := scanTodo(tx.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = ?", changes[i].ID))
+		if err != nil {
+			return nil, err
+		}
+		changes[i].Todo = &todo
+	}
+	return changes, nil
+}
+
+// userListIDs 返回用户所在的全部清单
+func userListIDs(tx *sql.Tx, userID int) ([]int, error) {
+	rows, err := tx.Query("SELECT list_id FROM list_members WHERE user_id = ? ORDER BY list_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ===== 冲突解决 =====
+
+// sameJSONValue 比较两个 JSON 值，两个都是时间时比较时刻（时区写法可以不同）
+func sameJSONValue(a, b interface{}) bool {
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			ta, errA := time.Parse(time.RFC3339, sa)
+			tb, errB := time.Parse(time.RFC3339, sb)
+			if errA == nil && errB == nil {
+				return ta.Equal(tb)
+			}
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// decodeJSONValue 把 patch 中的一个值解码为与 toJSONObject 相同的表示
+func decodeJSONValue(raw json.RawMessage) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+// serverChangedAt 返回待办项在服务端最后一次修改的时间
+func serverChangedAt(c *batchContext, id int) (time.Time, error) {
+	var changedAt time.Time
+	err := c.tx.QueryRow("SELECT changed_at FROM todo_changes WHERE todo_id = ? AND deleted = 0", id).Scan(&changedAt)
+	return changedAt, err
+}
+
+// clientWins 客户端的修改时间晚于服务端时客户端获胜，相同或没有修改时间时服务端获胜
+func clientWins(change clientTodoChange, changedAt time.Time) bool {
+	return change.ModifiedAt != nil && change.ModifiedAt.After(changedAt)
+}
+
+func winnerName(client bool) string {
+	if client {
+		return "client"
+	}
+	return "server"
+}
+
+// ===== 处理客户端的修改 =====
+
+// applySyncChange 处理一条修改：新建、删除，或者把 patch 中需要写入的字段合并到待办项
+func (c *batchContext) applySyncChange(strategy string, change clientTodoChange) (syncResult, error) {
+	result := syncResult{UID: change.UID}
+	if change.UID == "" || len(change.UID) > 255 {
+		return result, &apiError{400, "uid is required and must be at most 255 characters"}
+	}
+	names := make([]string, 0, len(change.Patch))
+	for name := range change.Patch {
+		if !todoWritableFields[name] {
+			return result, &apiError{400, "Unknown or read-only field: " + name}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	id, err := findTodoByUID(c, change.UID)
+	if err != nil {
+		return result, err
+	}
+
+	// 服务端没有这个待办项：新建，或者已经在服务端被删除（修改不生效）
+	if id == 0 {
+		switch {
+		case change.Deleted:
+			result.Action = "unchanged"
+		case change.BaseVersion != 0:
+			result.Action = "rejected"
+			result.Conflicts = []syncConflict{{Field: "deleted", Client: false, Server: true, Winner: "server"}}
+		default:
+			uid, err := json.Marshal(change.UID)
+			if err != nil {
+				return result, err
+			}
+			fields := map[string]json.RawMessage{"uid": uid}
+			for name, value := range change.Patch {
+				fields[name] = value
+			}
+			data, err := json.Marshal(fields)
+			if err != nil {
+				return result, err
+			}
+			todo, err := c.create(batchOperation{Op: "create", Todo: data})
+			if err != nil {
+				return result, err
+			}
+			result.ID, result.Action, result.Todo = todo.ID, "created", todo
+		}
+		return result, nil
+	}
+
+	result.ID = id
+	if _, err := c.editableTodo(id); err != nil {
+		return result, err
+	}
+	current, err := loadTodo(c.tx, id, c.userID)
+	if err != nil {
+		return result, err
+	}
+	changedAt, err := serverChangedAt(c, id)
+	if err != nil {
+		return result, err
+	}
+	// 版本号没有变化说明客户端离线期间服务端没有修改过，不存在冲突
+	conflicted := current.Version != change.BaseVersion
+
+	if change.Deleted {
+		// 删除与服务端的修改冲突：lww 按修改时间决定，merge 保留服务端修改过的待办项
+		if conflicted {
+			wins := strategy == "lww" && clientWins(change, changedAt)
+			result.Conflicts = []syncConflict{{Field: "deleted", Client: true, Server: false, Winner: winnerName(wins)}}
+			if !wins {
+				result.Action, result.Todo = "rejected", &current
+				return result, nil
+			}
+		}
+		deleted, err := deleteTodosTx(c.tx, "id = ?", id)
+		if err != nil {
+			return result, err
+		}
+		c.events = append(c.events, deleted...)
+		result.Action = "deleted"
+		return result, nil
+	}
+
+	server, err := toJSONObject(current)
+	if err != nil {
+		return result, err
+	}
+	lwwWins := clientWins(change, changedAt)
+	apply := map[string]json.RawMessage{}
+	for _, name := range names {
+		value, err := decodeJSONValue(change.Patch[name])
+		if err != nil {
+			return result, &apiError{400, "Invalid value for " + name}
+		}
+		if sameJSONValue(value, server[name]) {
+			continue
+		}
+		if !conflicted {
+			apply[name] = change.Patch[name]
+			continue
+		}
+
+		// merge：服务端的值与 base 相同说明只有客户端修改过这个字段，直接采用
+		if strategy == "merge" {
+			if raw, ok := change.Base[name]; ok {
+				base, err := decodeJSONValue(raw)
+				if err != nil {
+					return result, &apiError{400, "Invalid base value for " + name}
+				}
+				if sameJSONValue(base, server[name]) {
+					apply[name] = change.Patch[name]
+					continue
+				}
+			}
+		}
+		// 两边都可能修改过：按修改时间决定（lww 不看 base，客户端修改的字段都在这里决定）
+		result.Conflicts = append(result.Conflicts, syncConflict{Field: name, Client: value, Server: server[name], Winner: winnerName(lwwWins)})
+		if lwwWins {
+			apply[name] = change.Patch[name]
+		}
+	}
+
+	if len(apply) == 0 {
+		result.Action, result.Todo = "unchanged", &current
+		if len(result.Conflicts) > 0 {
+			result.Action = "rejected"
+		}
+		return result, nil
+	}
+	data, err := json.Marshal(apply)
+	if err != nil {
+		return result, err
+	}
+	todo, err := c.update(batchOperation{Op: "update", ID: id, Todo: data})
+	if err != nil {
+		return result, err
+	}
+	result.Action, result.Todo = "updated", todo
+	return result, nil
+}
+
+// runSyncChange 在 SAVEPOINT 中处理一条修改，失败时只回滚这一条
+func (c *batchContext) runSyncChange(index int, strategy string, change clientTodoChange) syncResult {
+	failed := func(code int, message string) syncResult {
+		return syncResult{Index: index, UID: change.UID, Code: code, Message: message}
+	}
+	if _, err := c.tx.Exec("SAVEPOINT sync_change"); err != nil {
+		log.Println("Error creating savepoint:", err)
+		return failed(500, "Failed to apply change")
+	}
+	defer func() {
+		if _, err := c.tx.Exec("RELEASE sync_change"); err != nil {
+			log.Println("Error releasing savepoint:", err)
+		}
+	}()
+
+	events := len(c.events)
+	result, err := c.applySyncChange(strategy, change)
+	if err != nil {
+		if _, err := c.tx.Exec("ROLLBACK TO sync_change"); err != nil {
+			log.Println("Error rolling back savepoint:", err)
+		}
+		c.events = c.events[:events]
+
+		if apiErr, ok := err.(*apiError); ok {
+			return failed(apiErr.Code, apiErr.Message)
+		}
+		log.Printf("Error applying sync change %d: %v", index, err)
+		return failed(500, "Failed to apply change")
+	}
+
+	result.Index, result.Message = index, "OK"
+	return result
+}
+
+// ===== 同步 API =====
+
+// GET /api/sync?since=TOKEN - 返回 TOKEN 之后的变更和新的 TOKEN，不带 since 时为全量同步
+// lists 为用户现在所在的清单，客户端应删除不在这些清单中的待办项（退出或删除了清单）
+func getSyncChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSyncToken(r.URL.Query().Get("since"))
+	if err != nil {
+		sendError(w, 400, "Invalid sync token")
+		return
+	}
+
+	// 在同一个读事务中查询，保证变更、清单和新的 TOKEN 一致
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to sync")
+		return
+	}
+	defer tx.Rollback()
+
+	seq, err := currentSyncSeq(tx)
+	if err != nil {
+		log.Println("Error querying sync sequence:", err)
+		sendError(w, 500, "Failed to sync")
+		return
+	}
+	// TOKEN 比当前序号还大，通常是数据库被重建过，需要全量同步
+	if since > seq {
+		sendError(w, 410, "Sync token is no longer valid, sync again without since")
+		return
+	}
+
+	userID := currentUserID(r)
+	changes, err := querySyncChanges(tx, userID, since)
+	if err != nil {
+		log.Println("Error querying changes:", err)
+		sendError(w, 500, "Failed to sync")
+		return
+	}
+	lists, err := userListIDs(tx, userID)
+	if err != nil {
+		log.Println("Error querying lists:", err)
+		sendError(w, 500, "Failed to sync")
+		return
+	}
+
+	sendJSON(w, 0, "Success", map[string]interface{}{
+		"token":   strconv.FormatInt(seq, 10),
+		"changes": changes,
+		"lists":   lists,
+	})
+}
+
+// POST /api/sync - 上传客户端的修改，每条修改单独生效，返回每条的结果和冲突
+// 上传后客户端应再调用 GET /api/sync 取回服务端的变更（包括自己刚上传的修改）
+func postSyncChanges(w http.ResponseWriter, r *http.Request) {
+	var req syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, 400, "Invalid request body")
+		return
+	}
+	switch req.Strategy {
+	case "":
+		req.Strategy = "merge"
+	case "lww", "merge":
+	default:
+		sendError(w, 400, "strategy must be one of lww, merge")
+		return
+	}
+	if len(req.Changes) > maxSyncChanges {
+		sendError(w, 400, fmt.Sprintf("At most %d changes are allowed per sync", maxSyncChanges))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendError(w, 500, "Failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	c := &batchContext{tx: tx, userID: currentUserID(r)}
+	results := make([]syncResult, 0, len(req.Changes))
+	conflicts, failed := 0, 0
+	for i, change := range req.Changes {
+		result := c.runSyncChange(i, req.Strategy, change)
+		if result.Code != 0 {
+			failed++
+		}
+		if len(result.Conflicts) > 0 {
+			conflicts++
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing sync:", err)
+		sendError(w, 500, "Failed to commit sync")
+		return
+	}
+	publishTodoEvents(c.events...)
+
+	sendJSON(w, 0, "Sync completed", map[string]interface{}{
+		"strategy":  req.Strategy,
+		"total":     len(results),
+		"failed":    failed,
+		"conflicts": conflicts,
+		"results":   results,
+	})
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ===== 标签和扩展字段 =====
+//
+// tags 与 todo.txt 一致：+project 表示项目，@context 表示场景；
+// extensions 保存 todo.txt 中其他的 key:value，导入导出时原样保留。
+
+// 标签和扩展字段的数量及长度上限
+const (
+	maxTags       = 50
+	maxTagLength  = 100
+	maxExtensions = 50
+)
+
+var (
+	tagPattern          = regexp.MustCompile(`^[+@]\S+$`)
+	extensionKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+)
+
+// todo.txt 中由待办项字段表示的 key，不能作为扩展字段
+var reservedTodoTxtKeys = map[string]bool{
+	"due":   true,
+	"pri":   true,
+	"uid":   true,
+	"rrule": true,
+	"tz":    true,
+}
+
+// normalizeTags 检查标签和扩展字段，去掉重复的标签；为空时设为 [] 和 {}
+func normalizeTags(todo *Todo) error {
+	tags := make([]string, 0, len(todo.Tags))
+	seen := map[string]bool{}
+	for _, tag := range todo.Tags {
+		if !tagPattern.MatchString(tag) || utf8.RuneCountInString(tag) > maxTagLength {
+			return fmt.Errorf("invalid tag %q: tags start with + (project) or @ (context) and contain no spaces", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		return fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	todo.Tags = tags
+
+	if len(todo.Extensions) > maxExtensions {
+		return fmt.Errorf("at most %d extensions are allowed", maxExtensions)
+	}
+	for key, value := range todo.Extensions {
+		if !extensionKeyPattern.MatchString(key) || reservedTodoTxtKeys[strings.ToLower(key)] {
+			return fmt.Errorf("invalid extension key %q", key)
+		}
+		if value == "" || strings.ContainsAny(value, " \t\r\n") {
+			return fmt.Errorf("extension %s must be a non-empty value without spaces", key)
+		}
+	}
+	if todo.Extensions == nil {
+		todo.Extensions = map[string]string{}
+	}
+	return nil
+}
+
+// tagsJSON / extensionsJSON 把标签和扩展字段写成数据库中的 JSON
+func tagsJSON(tags []string) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+func extensionsJSON(extensions map[string]string) string {
+	if len(extensions) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(extensions)
+	return string(data)
+}
+
+// scanTags 读取数据库中的标签和扩展字段
+func scanTags(todo *Todo, tags, extensions string) error {
+	todo.Tags = []string{}
+	todo.Extensions = map[string]string{}
+	if err := json.Unmarshal([]byte(tags), &todo.Tags); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(extensions), &todo.Extensions)
+}
+
+// ===== todo.txt =====
+//
+// 每行一个待办项，格式见 https://github.com/todotxt/todo.txt：
+//   x 2024-01-16 2024-01-10 交周报 +work @office pri:B due:2024-01-16 uid:3f2a...@todo-app
+//   (A) 2024-01-10 修自行车 +home due:2024-01-20T10:00:00Z
+// 已完成的待办项按惯例把优先级写成 pri:X；due 只有日期时表示当天结束（UTC），
+// rrule / tz 为重复规则，uid 用于导入时找到原来的待办项。描述没有对应的写法，不导出，导入时保持不变。
+// 标题中看起来像标签或 key:value 的词导出时前面加 \（如 \@home、\due:friday），导入时去掉，
+// 标题中词之间的空白原样保留（换行写成空格）。
+
+// 优先级与 todo.txt 字母的对应：(C) 和没有优先级都是 normal，D 及以后都是 low
+var todoTxtPriorities = map[string]string{"urgent": "A", "high": "B", "low": "D"}
+
+const todoTxtDateLayout = "2006-01-02"
+
+var todoTxtPriorityPattern = regexp.MustCompile(`^\([A-Z]\)$`)
+
+func priorityFromTodoTxt(letter string) string {
+	switch {
+	case letter == "A":
+		return "urgent"
+	case letter == "B":
+		return "high"
+	case letter == "C":
+		return defaultPriority
+	}
+	return "low"
+}
+
+// isTodoTxtDate 检查是否为 YYYY-MM-DD 格式的日期
+func isTodoTxtDate(word string) (time.Time, bool) {
+	if len(word) != len(todoTxtDateLayout) {
+		return time.Time{}, false
+	}
+	day, err := time.Parse(todoTxtDateLayout, word)
+	return day, err == nil
+}
+
+// formatTodoTxtDue 截止时间为当天结束（UTC）时只写日期，否则写完整的 RFC 3339 时间
+func formatTodoTxtDue(due time.Time) string {
+	due = due.UTC()
+	if due.Hour() == 23 && due.Minute() == 59 && due.Second() == 59 {
+		return due.Format(todoTxtDateLayout)
+	}
+	return due.Format(time.RFC3339)
+}
+
+// formatTodoTxt 把待办项写成一行 todo.txt
+func formatTodoTxt(todo Todo) string {
+	var words []string
+	if todo.Done {
+		words = append(words, "x")
+		if todo.CompletedAt != nil {
+			words = append(words, todo.CompletedAt.UTC().Format(todoTxtDateLayout))
+		}
+	} else if letter := todoTxtPriorities[todo.Priority]; letter != "" {
+		words = append(words, "("+letter+")")
+	}
+	words = append(words, todo.CreatedAt.UTC().Format(todoTxtDateLayout))
+	if title := formatTodoTxtTitle(todo.Title); title != "" {
+		words = append(words, title)
+	}
+	words = append(words, todo.Tags...)
+
+	if todo.Done {
+		if letter := todoTxtPriorities[todo.Priority]; letter != "" {
+			words = append(words, "pri:"+letter)
+		}
+	}
+	if todo.DueAt != nil {
+		words = append(words, "due:"+formatTodoTxtDue(*todo.DueAt))
+	}
+	if todo.Recurrence != "" {
+		words = append(words, "rrule:"+todo.Recurrence, "tz:"+todo.RecurrenceTZ)
+	}
+
+	keys := make([]string, 0, len(todo.Extensions))
+	for key := range todo.Extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		words = append(words, key+":"+todo.Extensions[key])
+	}
+	words = append(words, "uid:"+todo.UID)
+	return strings.Join(words, " ")
+}
+
+// formatTodoTxtTitle 写出标题：保留词之间的空白，换行写成空格，会被识别为标签或扩展字段的词前面加 \
+func formatTodoTxtTitle(title string) string {
+	var b strings.Builder
+	for i, word := range splitTodoTxtWords(title) {
+		if i > 0 {
+			if strings.ContainsAny(word.sep, "\r\n") {
+				b.WriteByte(' ')
+			} else {
+				b.WriteString(word.sep)
+			}
+		}
+		if isTodoTxtSpecial(word.text) {
+			b.WriteByte('\\')
+		}
+		b.WriteString(word.text)
+	}
+	return b.String()
+}
+
+// writeTodoTxt 每个待办项一行
+func writeTodoTxt(todos []Todo) []byte {
+	var buf bytes.Buffer
+	for _, todo := range todos {
+		buf.WriteString(formatTodoTxt(todo))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// splitTodoTxtExtension 拆分 key:value，key 以字母开头，value 不能为空，也不能以 // 开头（避免把网址当成扩展字段）
+func splitTodoTxtExtension(word string) (string, string, bool) {
+	key, value, ok := strings.Cut(word, ":")
+	if !ok || value == "" || strings.HasPrefix(value, "//") || !extensionKeyPattern.MatchString(key) {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// todoTxtWord 是一行 todo.txt 中的一个词，sep 为它前面的空白
+type todoTxtWord struct {
+	text, sep string
+}
+
+// splitTodoTxtWords 按空白拆分，保留每个词前面的空白，用于还原标题
+func splitTodoTxtWords(line string) []todoTxtWord {
+	var words []todoTxtWord
+	for {
+		text := strings.TrimLeftFunc(line, unicode.IsSpace)
+		if text == "" {
+			return words
+		}
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		words = append(words, todoTxtWord{text: text[:end], sep: line[:len(line)-len(text)]})
+		line = text[end:]
+	}
+}
+
+// isTodoTxtTag 检查是否为 +project 或 @context
+func isTodoTxtTag(word string) bool {
+	return len(word) > 1 && (word[0] == '+' || word[0] == '@')
+}
+
+// isTodoTxtSpecial 检查标题中的词导出时是否需要加 \：会被识别为标签或扩展字段，
+// 或者本身以 \ 开头、去掉后是这样的词（保证导入时去掉的 \ 一定是导出时加的）
+func isTodoTxtSpecial(word string) bool {
+	if rest, ok := strings.CutPrefix(word, `\`); ok {
+		return isTodoTxtSpecial(rest)
+	}
+	_, _, ok := splitTodoTxtExtension(word)
+	return ok || isTodoTxtTag(word)
+}
+
+// parseTodoTxtLine 解析一行 todo.txt
+func parseTodoTxtLine(line string) (importEntry, error) {
+	var entry importEntry
+	todo := Todo{Extensions: map[string]string{}}
+	words := splitTodoTxtWords(line)
+
+	// 开头依次为：完成标记和完成日期，或者优先级；然后是创建日期
+	i := 0
+	if words[0].text == "x" {
+		todo.Done = true
+		i++
+		if i < len(words) {
+			if day, ok := isTodoTxtDate(words[i].text); ok {
+				todo.CompletedAt = &day
+				i++
+			}
+		}
+	} else if todoTxtPriorityPattern.MatchString(words[0].text) {
+		todo.Priority = priorityFromTodoTxt(words[0].text[1:2])
+		i++
+	}
+	if i < len(words) {
+		if day, ok := isTodoTxtDate(words[i].text); ok {
+			entry.CreatedAt = &day
+			i++
+		}
+	}
+
+	// 标题中连续的词保留原来的空白，被标签或扩展字段隔开的词之间用一个空格
+	var title strings.Builder
+	inTitle := false
+	for _, word := range words[i:] {
+		if isTodoTxtTag(word.text) {
+			todo.Tags = append(todo.Tags, word.text)
+			inTitle = false
+			continue
+		}
+		key, value, ok := splitTodoTxtExtension(word.text)
+		if !ok {
+			if title.Len() > 0 {
+				if inTitle {
+					title.WriteString(word.sep)
+				} else {
+					title.WriteByte(' ')
+				}
+			}
+			text := word.text
+			if rest, ok := strings.CutPrefix(text, `\`); ok && isTodoTxtSpecial(rest) {
+				text = rest
+			}
+			title.WriteString(text)
+			inTitle = true
+			continue
+		}
+		inTitle = false
+
+		switch strings.ToLower(key) {
+		case "due":
+			if day, ok := isTodoTxtDate(value); ok {
+				due := day.AddDate(0, 0, 1).Add(-time.Second)
+				todo.DueAt = &due
+			} else if due, err := time.Parse(time.RFC3339, value); err == nil {
+				due = due.UTC()
+				todo.DueAt = &due
+			} else {
+				return entry, errors.New("due must be YYYY-MM-DD or an RFC 3339 time")
+			}
+		case "pri":
+			if len(value) != 1 || value[0] < 'A' || value[0] > 'Z' {
+				return entry, errors.New("pri must be a letter A-Z")
+			}
+			if todo.Done {
+				todo.Priority = priorityFromTodoTxt(value)
+			}
+		case "uid":
+			todo.UID = value
+		case "rrule":
+			todo.Recurrence = value
+		case "tz":
+			todo.RecurrenceTZ = value
+		default:
+			todo.Extensions[key] = value
+		}
+	}
+
+	todo.Title = title.String()
+	if todo.Title == "" {
+		return entry, errors.New("title is required")
+	}
+	priority, err := validateTodo(&todo)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Todo, entry.Priority = todo, priority
+	entry.keep = func(current Todo, todo *Todo) {
+		todo.Desc = current.Desc
+		// 完成日期没有变化时保留原来的完成时间
+		if todo.CompletedAt != nil && current.CompletedAt != nil &&
+			todo.CompletedAt.Format(todoTxtDateLayout) == current.CompletedAt.UTC().Format(todoTxtDateLayout) {
+			todo.CompletedAt = current.CompletedAt
+		}
+	}
+	return entry, nil
+}
+
+// parseTodoTxt 解析导入的 todo.txt 文件，忽略空行
+func parseTodoTxt(data []byte) ([]importEntry, error) {
+	var entries []importEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxImportSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" {
+			continue
+		}
+		if len(entries) == maxImportTodos {
+			return nil, fmt.Errorf("at most %d todos can be imported at once", maxImportTodos)
+		}
+		entry, err := parseTodoTxtLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ===== API 处理器 =====
+
+// GET /api/todos.txt - 以 todo.txt 格式导出用户所在清单中的全部待办项
+// GET /api/lists/{listID}/todos.txt - 只导出指定清单
+func exportTodoTxt(w http.ResponseWriter, r *http.Request) {
+	todos, ok := exportableTodos(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="todo.txt"`)
+	w.Write(writeTodoTxt(todos))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	created := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		title string
+		want  string // 导入后的标题，空表示与 title 相同
+	}{
+		{"context only", "@home", ""},
+		{"project only", "+1", ""},
+		{"due word", "Pay bill due:friday", ""},
+		{"plus word", "Reply with +1 ASAP", ""},
+		{"extension word", "Meet at 10:30 note:x", ""},
+		{"reserved keys", "uid:x pri:A rrule:y tz:z", ""},
+		{"escaped already", `\@home and \\due:x`, ""},
+		{"plain backslash", `C:\temp \ ok`, ""},
+		{"url", "read https://example.com/a:b", ""},
+		{"repeated spaces", "a  b   c", ""},
+		{"tabs and ideographic space", "周报\t草稿　第二版", ""},
+		{"line break", "first line\nsecond  line", "first line second  line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo := Todo{
+				UID:        "3f2a@todo-app",
+				Title:      tt.title,
+				Priority:   "high",
+				DueAt:      &due,
+				Tags:       []string{"+work", "@office"},
+				Extensions: map[string]string{"est": "2h"},
+				CreatedAt:  created,
+			}
+			line := formatTodoTxt(todo)
+			entries, err := parseTodoTxt(writeTodoTxt([]Todo{todo}))
+			if err != nil {
+				t.Fatalf("parseTodoTxt(%q): %v", line, err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("parseTodoTxt(%q) returned %d entries", line, len(entries))
+			}
+
+			got := entries[0].Todo
+			want := tt.want
+			if want == "" {
+				want = tt.title
+			}
+			if got.Title != want {
+				t.Errorf("title of %q = %q, want %q", line, got.Title, want)
+			}
+			if !reflect.DeepEqual(got.Tags, todo.Tags) {
+				t.Errorf("tags of %q = %q, want %q", line, got.Tags, todo.Tags)
+			}
+			if !reflect.DeepEqual(got.Extensions, todo.Extensions) {
+				t.Errorf("extensions of %q = %v, want %v", line, got.Extensions, todo.Extensions)
+			}
+			if got.UID != todo.UID || got.Priority != todo.Priority || got.DueAt == nil || !got.DueAt.Equal(due) {
+				t.Errorf("fields of %q = uid %q, priority %q, due %v", line, got.UID, got.Priority, got.DueAt)
+			}
+		})
+	}
+}
+
+func TestParseTodoTxtLineTitle(t *testing.T) {
+	// 其他工具写的 todo.txt：标签和扩展字段可以夹在标题中间
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"2024-01-10 Call  mom +family about it", "Call  mom about it"},
+		{"Buy milk @store est:5m  soon", "Buy milk soon"},
+		{`\@home`, "@home"},
+		{`\foo \\bar`, `\foo \\bar`},
+	}
+
+	for _, tt := range tests {
+		entry, err := parseTodoTxtLine(tt.line)
+		if err != nil {
+			t.Errorf("parseTodoTxtLine(%q): %v", tt.line, err)
+			continue
+		}
+		if entry.Todo.Title != tt.want {
+			t.Errorf("parseTodoTxtLine(%q) title = %q, want %q", tt.line, entry.Todo.Title, tt.want)
+		}
+	}
+}